@@ -2,33 +2,356 @@ package gottani
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"go/build"
+	"io"
+	"io/fs"
+	"time"
 
 	"github.com/ktateish/gottani/internal/appinfo"
 	"github.com/ktateish/gottani/internal/pkginfo"
 )
 
+// Options is a set of options for CombineWithOptions.
+// The zero value is the same setting as Combine.
+// The keys in the struct tags are the ones in config files (see Config).
+type Options struct {
+	// Modules makes gottani resolve the whole import graph through the go
+	// command instead of go/build.  Use it for go.work workspaces, replace
+	// directives pointing sibling checkouts, and modules in the module cache.
+	Modules bool `toml:"modules" json:"modules"`
+
+	// GOOS and GOARCH are the target of the combined source, e.g. the
+	// judge's environment.  The host's ones are used if they are empty.
+	GOOS   string `toml:"goos" json:"goos"`
+	GOARCH string `toml:"goarch" json:"goarch"`
+
+	// BuildTags are additional build tags to select files like `go build -tags`.
+	BuildTags []string `toml:"tags" json:"tags"`
+
+	// CgoEnabled is the same as CGO_ENABLED.  If it is nil, it follows the
+	// go command: the environment variable or the default of the target.
+	CgoEnabled *bool `toml:"cgo" json:"cgo"`
+
+	// FS is the file system which the application and its libraries are
+	// read from instead of the disk, e.g. a zip archive or fstest.MapFS.
+	// The dir given to Combine and the paths in Overlay are relative to
+	// its root then.  Imports are resolved by the go.mod files in it, or as
+	// GOPATH/src for paths not in any of the modules.  Standard packages
+	// are still read from GOROOT.  Modules and Vendor are not supported
+	// with it.
+	FS fs.FS `toml:"-" json:"-"`
+
+	// Overlay maps absolute paths of files to their contents which are
+	// used instead of the files on the disk, e.g. unsaved buffers of an
+	// editor.  It works like Overlay of golang.org/x/tools/go/packages.
+	// The //line directives in the combined source still point to the
+	// real paths.
+	Overlay map[string][]byte `toml:"-" json:"-"`
+
+	// Vendor makes gottani resolve imports from the vendor directory of the
+	// main module like `go build -mod=vendor`.  Vendored packages are
+	// combined like other non-standard packages.
+	Vendor bool `toml:"vendor" json:"vendor"`
+
+	// StdExportData makes gottani import standard packages from the export
+	// data compiled by the go command (and kept in its build cache) instead
+	// of parsing and type-checking their source on every run.
+	StdExportData bool `toml:"stdexport" json:"stdexport"`
+
+	// GOROOT is the root of the Go tree used by the judge, e.g. a checkout of
+	// its version.  Its standard packages are used for type-checking instead
+	// of the local ones so that symbols missing in the judge are reported.
+	// StdExportData is ignored if it is given.
+	GOROOT string `toml:"goroot" json:"goroot"`
+
+	// GoVersion is the Go version of the judge such as "go1.20".  Language
+	// features of later versions are reported as errors.  If it is empty,
+	// the version in GOROOT/VERSION is used when GOROOT is given.
+	GoVersion string `toml:"go" json:"go"`
+
+	// CacheDir is a directory to keep type-checked packages and resolved
+	// imports across runs.  An unchanged package is restored from it by
+	// parsing its files without type-checking.  The cache is disabled if it
+	// is empty.  It can't be used with PruneMethods nor PruneFields, which
+	// need the types of expressions the cache doesn't keep.  See also
+	// GetCacheStats and CleanCache.
+	CacheDir string `toml:"cache" json:"cache"`
+
+	// Parallel makes gottani parse and type-check independent packages in
+	// parallel.  The result is the same as the sequential loading.
+	Parallel bool `toml:"parallel" json:"parallel"`
+
+	// Keep are the import path patterns of non-standard packages which stay
+	// as imports like standard ones instead of being combined, e.g. ones
+	// provided by the judge.  A pattern ending with "/..." matches the
+	// packages under it as well.  Allowed of Profile are also kept.
+	Keep []string `toml:"keep" json:"keep"`
+
+	// Inline are the import path patterns of standard packages which are
+	// combined like non-standard ones, e.g. slices and maps for a judge
+	// whose Go lacks them.  They are type-checked with the function bodies,
+	// and StdExportData is ignored if it is given.  Packages using internal
+	// packages in the reachable code can't be inlined.
+	Inline []string `toml:"inline" json:"inline"`
+
+	// Replace maps import paths to the ones of the packages used instead,
+	// e.g. a variant of a library for the judge, without touching go.mod
+	// or build tags.  A replacement must have all the exported identifiers
+	// of the replaced package with the same types.
+	Replace map[string]string `toml:"replace" json:"replace"`
+
+	// PruneMethods drops the methods which the application never calls,
+	// instead of keeping all the methods of the used types.  A method is
+	// kept if it is called, taken as a method value, or in the method set of
+	// an interface which its type is converted to (rapid type analysis).
+	// For the empty interface and error, whose values standard packages
+	// inspect, only String, Error, Format, GoString, Unwrap, Is and As are
+	// kept, so other methods called through reflection or type assertions
+	// in external packages, e.g. MarshalJSON, are dropped.
+	PruneMethods bool `toml:"prune_methods" json:"prune_methods"`
+
+	// PruneFields drops the fields of struct types which the application
+	// never reads nor writes, and their values in positional composite
+	// literals.  The fields of a type are kept if its values may be seen as a
+	// whole: converted to the empty interface (e.g. printed by fmt or given
+	// to reflect and encoding/*) directly or through other interfaces,
+	// converted to other types, compared, used as map keys or given to
+	// unsafe.Sizeof.
+	PruneFields bool `toml:"prune_fields" json:"prune_fields"`
+
+	// Profile is the judge which the combined source is validated against.
+	// Its GoVersion is used if GoVersion is empty.  See also Profiles.
+	Profile *Profile `toml:"-" json:"-"`
+
+	// Log receives the progress of combining: the loaded non-standard
+	// packages and the time taken by each phase.  Nothing is reported if it
+	// is nil.
+	Log io.Writer `toml:"-" json:"-"`
+
+	// SideEffects receives the declarations kept for their side effects
+	// even though the entry point doesn't reach them, one per line with its
+	// position: package-level vars whose initializers call functions, blank
+	// vars like `var _ I = (*T)(nil)`, init functions of blank-imported
+	// packages and blank imports of standard packages.
+	SideEffects io.Writer `toml:"-" json:"-"`
+}
+
+var (
+	// ErrLoad is wrapped by the errors in loading packages, e.g. a missing
+	// package, an error in the Go source or a package given as Inline which
+	// can't be inlined.
+	ErrLoad = errors.New("loading package information")
+
+	// ErrCombine is wrapped by the errors in combining the loaded packages.
+	// They are bugs of gottani.
+	ErrCombine = errors.New("combining")
+
+	// ErrEntryPoint is wrapped by the error that the main package has no
+	// function of the entry point name.
+	ErrEntryPoint = errors.New("entry point not found")
+
+	// ErrOptions is wrapped by the errors of Options which can't be used
+	// together.
+	ErrOptions = errors.New("invalid options")
+)
+
 // Combine returns an application source code created by combining all
 // functions, vars, consts, types that are reachable form the given entry
 // point of the package in the given dir.
 func Combine(dir, entryPointName string) ([]byte, error) {
-	pi, err := pkginfo.New(dir)
-	if err != nil {
-		return nil, fmt.Errorf("loading package information: %w", err)
+	return CombineWithOptions(dir, entryPointName, nil)
+}
+
+// CombineWithOptions is the same as Combine but it takes Options.
+// The nil opts is the same as the zero value of Options.
+func CombineWithOptions(dir, entryPointName string, opts *Options) ([]byte, error) {
+	return NewCombiner(opts).Combine(dir, entryPointName)
+}
+
+// CombineFiles is the same as CombineWithOptions but the package of the entry
+// point consists of the given files in a directory like `go run file.go`.
+// Build constraints of the files are ignored.  Give Options.Overlay to
+// combine source which is not on the disk, e.g. read from stdin.
+func CombineFiles(files []string, entryPointName string, opts *Options) ([]byte, error) {
+	return NewCombiner(opts).CombineFiles(files, entryPointName)
+}
+
+// Combiner combines applications sharing parsed and type-checked packages
+// among calls.  A package is loaded again only when its files or the
+// packages it imports have been changed.
+// It is safe for concurrent use by multiple goroutines.
+type Combiner struct {
+	cache   *pkginfo.Cache
+	app     appinfo.Config
+	profile *Profile
+	log     io.Writer
+	effects io.Writer
+	err     error // error of the options returned by every call
+}
+
+// NewCombiner creates Combiner with the given opts.
+// The nil opts is the same as the zero value of Options.
+func NewCombiner(opts *Options) *Combiner {
+	if opts == nil {
+		opts = &Options{}
+	}
+	cfg := pkginfo.Config{
+		Modules:       opts.Modules,
+		GOOS:          opts.GOOS,
+		GOARCH:        opts.GOARCH,
+		BuildTags:     opts.BuildTags,
+		CgoEnabled:    opts.CgoEnabled,
+		FS:            opts.FS,
+		Overlay:       opts.Overlay,
+		Vendor:        opts.Vendor,
+		StdExportData: opts.StdExportData,
+		GOROOT:        opts.GOROOT,
+		GoVersion:     opts.GoVersion,
+		CacheDir:      opts.CacheDir,
+		Parallel:      opts.Parallel,
+		Keep:          opts.Keep,
+		Inline:        opts.Inline,
+		Replace:       opts.Replace,
+	}
+	if opts.Profile != nil {
+		if cfg.GoVersion == "" {
+			cfg.GoVersion = opts.Profile.GoVersion
+		}
+		cfg.Keep = append(cfg.Keep[:len(cfg.Keep):len(cfg.Keep)], opts.Profile.Allowed...)
+	}
+	var err error
+	if cfg.CacheDir != "" && (opts.PruneMethods || opts.PruneFields) {
+		// packages restored from the disk cache lack the types of expressions
+		err = fmt.Errorf("%w: CacheDir can't be used with PruneMethods nor PruneFields", ErrOptions)
+	}
+	return &Combiner{
+		cache: pkginfo.NewCache(cfg),
+		app: appinfo.Config{
+			PruneMethods: opts.PruneMethods,
+			PruneFields:  opts.PruneFields,
+		},
+		profile: opts.Profile,
+		log:     opts.Log,
+		effects: opts.SideEffects,
+		err:     err,
 	}
+}
 
-	ai := appinfo.NewApplicationInfo(pi, entryPointName)
+// Combine is the same as the function Combine but it shares packages with
+// other calls of the Combiner.
+func (c *Combiner) Combine(dir, entryPointName string) ([]byte, error) {
+	_, src, err := c.combine(func() (*pkginfo.PackageInfo, error) {
+		return pkginfo.NewWithCache(dir, c.cache)
+	}, entryPointName)
+	return src, err
+}
 
-	app, err := ai.Squash()
+// BuildContext returns the build.Context of the target given by the options
+// for finding packages in the same way as the Combiner loads them.  Sources
+// combined by gottani are ignored.
+func (c *Combiner) BuildContext() *build.Context {
+	return c.cache.BuildContext()
+}
+
+// CombineFiles is the same as the function CombineFiles but it shares
+// packages with other calls of the Combiner.
+func (c *Combiner) CombineFiles(files []string, entryPointName string) ([]byte, error) {
+	_, src, err := c.combine(func() (*pkginfo.PackageInfo, error) {
+		return pkginfo.NewFilesWithCache(files, c.cache)
+	}, entryPointName)
+	return src, err
+}
+
+// combine combines the application loaded by the load function.  It also
+// returns the loaded packages, which is nil if the load fails.
+func (c *Combiner) combine(load func() (*pkginfo.PackageInfo, error), entryPointName string) (pi *pkginfo.PackageInfo, src []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			src, err = nil, fmt.Errorf("%w: panic: %v", ErrCombine, r)
+		}
+	}()
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+
+	start := time.Now()
+	pi, err = load()
 	if err != nil {
-		return nil, fmt.Errorf("creating combined application: %w", err)
+		return pi, nil, fmt.Errorf("%w: %w", ErrLoad, err)
+	}
+	if c.log != nil {
+		pkgs := pi.Packages()
+		c.logf("loaded %d packages (%d standard) in %v", len(pi.AllPackages()), len(pi.AllPackages())-len(pkgs), time.Since(start))
+		for _, bp := range pkgs {
+			c.logf("  %s (%d files in %s)", bp.ImportPath, len(bp.GoFiles)+len(bp.CgoFiles), bp.Dir)
+		}
+	}
+
+	start = time.Now()
+	ai := appinfo.NewApplicationInfoWithConfig(pi, entryPointName, c.app)
+	if ai.GetEntryPointDecl() == nil {
+		return pi, nil, fmt.Errorf("%w: func %s in the package", ErrEntryPoint, entryPointName)
+	}
+	app, err := ai.Squash()
+	if errors.Is(err, appinfo.ErrNotInlinable) {
+		// the standard package can't be used as the library
+		return pi, nil, fmt.Errorf("%w: %w", ErrLoad, err)
+	} else if err != nil {
+		return pi, nil, fmt.Errorf("%w: creating combined application: %w", ErrCombine, err)
+	}
+	c.logf("squashed in %v", time.Since(start))
+	if c.effects != nil {
+		for _, nd := range ai.GetSideEffectRoots() {
+			fmt.Fprintln(c.effects, ai.DescribeSideEffectRoot(nd))
+		}
 	}
 
+	start = time.Now()
 	w := new(bytes.Buffer)
 	err = app.Fprint(w)
 	if err != nil {
-		return nil, fmt.Errorf("formatting: %w", err)
+		return pi, nil, fmt.Errorf("%w: formatting: %w", ErrCombine, err)
+	}
+	c.logf("formatted %d bytes in %v", w.Len(), time.Since(start))
+
+	if c.profile != nil {
+		if err := c.profile.validate(w.Bytes(), c.BuildContext().GOROOT); err != nil {
+			return pi, nil, err
+		}
 	}
 
-	return w.Bytes(), nil
+	return pi, w.Bytes(), nil
+}
+
+// logf reports the progress to Options.Log if given
+func (c *Combiner) logf(format string, args ...any) {
+	if c.log != nil {
+		fmt.Fprintf(c.log, format+"\n", args...)
+	}
+}
+
+// CacheStats is statistics of a cache directory given as Options.CacheDir.
+type CacheStats struct {
+	Packages int   // number of type-checked packages
+	Dirs     int   // number of resolved import paths
+	Size     int64 // total size of the entries in bytes
+}
+
+// GetCacheStats returns the statistics of the cache directory.
+func GetCacheStats(dir string) (CacheStats, error) {
+	st, err := pkginfo.GetDiskCacheStats(dir)
+	if err != nil {
+		return CacheStats{}, fmt.Errorf("reading cache %q: %w", dir, err)
+	}
+	return CacheStats(st), nil
+}
+
+// CleanCache removes all entries in the cache directory.
+func CleanCache(dir string) error {
+	if err := pkginfo.CleanDiskCache(dir); err != nil {
+		return fmt.Errorf("cleaning cache %q: %w", dir, err)
+	}
+	return nil
 }
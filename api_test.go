@@ -1,13 +1,23 @@
 package gottani_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"go/scanner"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/ktateish/gottani"
 )
@@ -39,59 +49,1329 @@ func TestCombine(t *testing.T) {
 	for _, tc := range testCases {
 		dir := tc
 		t.Run(dir, func(t *testing.T) {
-			// reset to cwd
-			if err := os.Chdir(cwd); err != nil {
-				t.Fatalf("Failed to enter directory: %s: %s", cwd, err)
+			testCombine(t, cwd, dir, nil)
+		})
+	}
+}
+
+func TestCombineWithOptions(t *testing.T) {
+	noCgo := false
+	testCases := []struct {
+		dir  string
+		opts *gottani.Options
+	}{
+		// module aware loader
+		{"examples/01-simple", &gottani.Options{Modules: true}},
+		{"testdata/issue2", &gottani.Options{Modules: true}},
+		{"examples/05-renaming", &gottani.Options{Modules: true}},
+		{"examples/07-methods", &gottani.Options{Modules: true}},
+		{"examples/08-cgo", &gottani.Options{Modules: true}},
+		{"testdata/issue3", &gottani.Options{Modules: true}},
+		{"testdata/issue6", &gottani.Options{Modules: true}},
+		{"testdata/workspace", &gottani.Options{Modules: true}},
+
+		// target build configuration
+		{"testdata/target", &gottani.Options{GOOS: "windows", BuildTags: []string{"judge"}, CgoEnabled: &noCgo}},
+		{"testdata/target", &gottani.Options{GOOS: "windows", BuildTags: []string{"judge"}, CgoEnabled: &noCgo, Modules: true}},
+
+		// standard packages from export data
+		{"examples/05-renaming", &gottani.Options{StdExportData: true}},
+		{"examples/07-methods", &gottani.Options{StdExportData: true}},
+		{"examples/08-cgo", &gottani.Options{StdExportData: true}},
+		{"testdata/issue5", &gottani.Options{StdExportData: true}},
+		{"testdata/issue6", &gottani.Options{StdExportData: true, Modules: true}},
+		{"testdata/target", &gottani.Options{GOOS: "windows", BuildTags: []string{"judge"}, CgoEnabled: &noCgo, StdExportData: true}},
+
+		// parallel loading
+		{"examples/05-renaming", &gottani.Options{Parallel: true}},
+		{"examples/07-methods", &gottani.Options{Parallel: true, StdExportData: true}},
+		{"examples/08-cgo", &gottani.Options{Parallel: true, Modules: true}},
+		{"testdata/issue5", &gottani.Options{Parallel: true}},
+		{"testdata/issue6", &gottani.Options{Parallel: true, StdExportData: true, Modules: true}},
+		{"testdata/workspace", &gottani.Options{Parallel: true, Modules: true}},
+
+		// vendor directory
+		{"testdata/vendor", &gottani.Options{Vendor: true}},
+		{"testdata/vendor", &gottani.Options{Vendor: true, Modules: true}},
+		{"testdata/vendor", &gottani.Options{Vendor: true, Parallel: true, StdExportData: true}},
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed to get working dir: %s", err)
+	}
+	for _, tc := range testCases {
+		dir := tc.dir
+		opts := tc.opts
+		t.Run(dir, func(t *testing.T) {
+			// workspace mode doesn't accept -mod=mod
+			t.Setenv("GOFLAGS", "")
+			testCombine(t, cwd, dir, opts)
+		})
+	}
+}
+
+func TestCombiner(t *testing.T) {
+	testCases := []string{
+		"examples/01-simple",
+		"examples/02-simple",
+		"examples/05-renaming",
+		"examples/06-initializers",
+		"examples/07-methods",
+		"examples/08-cgo",
+		"testdata/issue2",
+		"testdata/issue3",
+		"testdata/issue5",
+	}
+
+	// the module aware loader doesn't depend on the working directory
+	c := gottani.NewCombiner(&gottani.Options{Modules: true})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		for _, tc := range testCases {
+			wg.Add(1)
+			go func(dir string) {
+				defer wg.Done()
+				wantSrc, err := os.ReadFile(filepath.Join(dir, "combined.go"))
+				if err != nil {
+					t.Errorf("Failed to read file: %s", err)
+					return
+				}
+				gotSrc, err := c.Combine(filepath.Join(dir, "src"), "main")
+				if err != nil {
+					t.Errorf("Failed to Combine(): %s: %s", dir, err)
+					return
+				}
+				if !bytes.Equal(gotSrc, wantSrc) {
+					t.Errorf("Combined source is wrong: %s", dir)
+				}
+			}(tc)
+		}
+	}
+	wg.Wait()
+}
+
+func TestCombinerBuildContext(t *testing.T) {
+	c := gottani.NewCombiner(&gottani.Options{GOOS: "windows", GOARCH: "arm64", BuildTags: []string{"judge"}, GoVersion: "go1.21"})
+	ctxt := c.BuildContext()
+	if ctxt.GOOS != "windows" || ctxt.GOARCH != "arm64" {
+		t.Errorf("BuildContext() is for %s/%s, want windows/arm64", ctxt.GOOS, ctxt.GOARCH)
+	}
+	if !slices.Contains(ctxt.BuildTags, "judge") {
+		t.Errorf("BuildContext() has tags %v, want judge", ctxt.BuildTags)
+	}
+	if slices.Contains(ctxt.ReleaseTags, "go1.22") || !slices.Contains(ctxt.ReleaseTags, "go1.21") {
+		t.Errorf("BuildContext() has release tags %v, want up to go1.21", ctxt.ReleaseTags)
+	}
+}
+
+func TestCombinerVendor(t *testing.T) {
+	// another module vendoring a different version of the same package
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for _, name := range []string{"go.mod", "src/main.go", "vendor/modules.txt", "vendor/example.com/ds/stack.go", "vendor/example.com/ds/list/list.go"} {
+		b, err := os.ReadFile(filepath.Join("testdata/vendor", name))
+		if err != nil {
+			t.Fatalf("Failed to read file: %s", err)
+		}
+		files[name] = string(b)
+	}
+	files["vendor/example.com/ds/stack.go"] = strings.Replace(files["vendor/example.com/ds/stack.go"], "LIFO stack", "vendored stack", 1)
+	if err := writeFiles(dir, files); err != nil {
+		t.Fatalf("Failed to write files: %s", err)
+	}
+
+	// the vendor directory is of the module of the importer, not of the
+	// working directory
+	c := gottani.NewCombiner(&gottani.Options{Vendor: true})
+	for _, tc := range []struct{ dir, want string }{
+		{"testdata/vendor", "LIFO stack"},
+		{dir, "vendored stack"},
+	} {
+		got, err := c.Combine(filepath.Join(tc.dir, "src"), "main")
+		if err != nil {
+			t.Fatalf("Failed to Combine(): %s: %s", tc.dir, err)
+		}
+		if !strings.Contains(string(got), tc.want) {
+			t.Errorf("Combined source of %s lacks %q:\n%s", tc.dir, tc.want, got)
+		}
+	}
+}
+
+func TestCombinerParallel(t *testing.T) {
+	dir := t.TempDir()
+	if err := generatePackages(dir, 8, 50); err != nil {
+		t.Fatalf("Failed to generate packages: %s", err)
+	}
+	srcDir := filepath.Join(dir, "src")
+
+	want, err := gottani.CombineWithOptions(srcDir, "main", &gottani.Options{Modules: true, StdExportData: true})
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+
+	c := gottani.NewCombiner(&gottani.Options{Modules: true, StdExportData: true, Parallel: true})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := c.Combine(srcDir, "main")
+			if err != nil {
+				t.Errorf("Failed to Combine(): %s", err)
+				return
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Combined source differs from the sequential loading:\n%s", got)
 			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCombinerReload(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, os.DirFS("testdata/issue4")); err != nil {
+		t.Fatalf("Failed to copy testdata: %s", err)
+	}
+	srcDir := filepath.Join(dir, "src")
+
+	c := gottani.NewCombiner(&gottani.Options{Modules: true})
+	before, err := c.Combine(srcDir, "main")
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+
+	libPath := filepath.Join(dir, "lib", "lib.go")
+	lib, err := os.ReadFile(libPath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %s", err)
+	}
+	lib = bytes.Replace(lib, []byte("return xmath.Pi"), []byte("return xmath.E"), 1)
+	if err := os.WriteFile(libPath, lib, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %s", err)
+	}
+
+	after, err := c.Combine(srcDir, "main")
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+	if !strings.Contains(string(before), "return math.Pi") {
+		t.Fatalf("Combined source before the change is wrong:\n%s", before)
+	}
+	if !strings.Contains(string(after), "return math.E") {
+		t.Fatalf("Combined source after the change is wrong:\n%s", after)
+	}
+}
+
+func TestCombineWithCacheDir(t *testing.T) {
+	cacheDir := t.TempDir()
+	testCases := []struct {
+		dir  string
+		opts *gottani.Options
+	}{
+		{"examples/01-simple", &gottani.Options{CacheDir: cacheDir}},
+		{"examples/05-renaming", &gottani.Options{CacheDir: cacheDir}},
+		{"examples/07-methods", &gottani.Options{CacheDir: cacheDir, StdExportData: true}},
+		{"examples/08-cgo", &gottani.Options{CacheDir: cacheDir, StdExportData: true}},
+		{"testdata/issue2", &gottani.Options{CacheDir: cacheDir, Modules: true}},
+		{"testdata/issue3", &gottani.Options{CacheDir: cacheDir, StdExportData: true}},
+		{"testdata/issue6", &gottani.Options{CacheDir: cacheDir, StdExportData: true, Modules: true}},
+		{"testdata/issue9", &gottani.Options{CacheDir: cacheDir, StdExportData: true}},
+		{"testdata/vendor", &gottani.Options{CacheDir: cacheDir, Vendor: true}},
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Failed to get working dir: %s", err)
+	}
+	for _, tc := range testCases {
+		dir := tc.dir
+		opts := tc.opts
+		t.Run(dir, func(t *testing.T) {
+			// the first run stores packages and the second one restores them
+			testCombine(t, cwd, dir, opts)
+			testCombine(t, cwd, dir, opts)
+		})
+	}
+
+	st, err := gottani.GetCacheStats(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to GetCacheStats(): %s", err)
+	}
+	if st.Packages == 0 || st.Size == 0 {
+		t.Errorf("No packages are stored: %+v", st)
+	}
+	if err := gottani.CleanCache(cacheDir); err != nil {
+		t.Fatalf("Failed to CleanCache(): %s", err)
+	}
+	st, err = gottani.GetCacheStats(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to GetCacheStats(): %s", err)
+	}
+	if st != (gottani.CacheStats{}) {
+		t.Errorf("Entries remain after CleanCache(): %+v", st)
+	}
+}
+
+func TestCombineWithCacheDirReload(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, os.DirFS("testdata/issue4")); err != nil {
+		t.Fatalf("Failed to copy testdata: %s", err)
+	}
+	srcDir := filepath.Join(dir, "src")
+	opts := &gottani.Options{Modules: true, StdExportData: true, CacheDir: t.TempDir()}
+
+	before, err := gottani.CombineWithOptions(srcDir, "main", opts)
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+
+	libPath := filepath.Join(dir, "lib", "lib.go")
+	lib, err := os.ReadFile(libPath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %s", err)
+	}
+	lib = bytes.Replace(lib, []byte("return xmath.Pi"), []byte("return xmath.E"), 1)
+	if err := os.WriteFile(libPath, lib, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %s", err)
+	}
+
+	after, err := gottani.CombineWithOptions(srcDir, "main", opts)
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+	if !strings.Contains(string(before), "return math.Pi") {
+		t.Fatalf("Combined source before the change is wrong:\n%s", before)
+	}
+	if !strings.Contains(string(after), "return math.E") {
+		t.Fatalf("Combined source after the change is wrong:\n%s", after)
+	}
+}
+
+func TestCombineWithGOROOT(t *testing.T) {
+	goroot := t.TempDir()
+	if err := writeFiles(goroot, map[string]string{
+		"VERSION":                "go1.20.14\ntime 2024-02-01T00:00:00Z\n",
+		"src/strings/strings.go": "package strings\n\nfunc ToUpper(s string) string { return s }\n",
+	}); err != nil {
+		t.Fatalf("Failed to write GOROOT: %s", err)
+	}
 
-			// prepare want result
+	testCases := []struct {
+		name    string
+		lib     string
+		opts    *gottani.Options
+		wantErr string
+	}{
+		{
+			"ok",
+			"package lib\n\nimport \"strings\"\n\nfunc F(s string) string { return strings.ToUpper(s) }\n",
+			&gottani.Options{Modules: true, GOROOT: goroot},
+			"",
+		},
+		{
+			"missing symbol",
+			"package lib\n\nimport \"strings\"\n\nfunc F(s string) string { return strings.ToLower(s) }\n",
+			&gottani.Options{Modules: true, GOROOT: goroot},
+			"lib.go:5:42: undefined: strings.ToLower",
+		},
+		{
+			"language version of GOROOT",
+			"package lib\n\nfunc F(s string) string { return s[:min(len(s), 3)] }\n",
+			&gottani.Options{Modules: true, GOROOT: goroot},
+			"lib.go:3:37: built-in min requires go1.21 or later",
+		},
+		{
+			"language version",
+			"package lib\n\nfunc F(s string) string {\n\tfor range 3 {\n\t}\n\treturn s\n}\n",
+			&gottani.Options{Modules: true, GoVersion: "go1.21"},
+			"lib.go:4:12: cannot range over 3",
+		},
+		{
+			"language version ok",
+			"package lib\n\nfunc F(s string) string { return s[:min(len(s), 3)] }\n",
+			&gottani.Options{Modules: true, GoVersion: "go1.21"},
+			"",
+		},
+		{
+			"ok without modules",
+			"package lib\n\nimport \"strings\"\n\nfunc F(s string) string { return strings.ToUpper(s[:min(len(s), 3)]) }\n",
+			&gottani.Options{GOROOT: goroot, GoVersion: "go1.21"},
+			"",
+		},
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %s", err)
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := writeFiles(dir, map[string]string{
+				"go.mod":     "module example.com/app\n\ngo 1.20\n",
+				"main.go":    "package main\n\nimport \"example.com/app/lib\"\n\nfunc main() { println(lib.F(\"abcd\")) }\n",
+				"lib/lib.go": tc.lib,
+			}); err != nil {
+				t.Fatalf("Failed to write files: %s", err)
+			}
+			if err := os.Chdir(dir); err != nil {
+				t.Fatalf("Failed to enter directory: %s: %s", dir, err)
+			}
+			defer os.Chdir(cwd)
+
+			_, err := gottani.CombineWithOptions(".", "main", tc.opts)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Failed to Combine(): %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Combine() succeeded unexpectedly")
+			}
+			want := filepath.Join(dir, "lib", tc.wantErr)
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("Combine() returned %q, want an error containing %q", err, want)
+			}
+		})
+	}
+}
+
+func TestCombineDotlessModule(t *testing.T) {
+	// packages of a module whose path has no dots are not standard
+	dir := t.TempDir()
+	if err := writeFiles(dir, map[string]string{
+		"go.mod":     "module contest\n\ngo 1.21\n",
+		"a/main.go":  "package main\n\nimport \"contest/lib\"\n\nfunc main() { println(lib.F(2)) }\n",
+		"lib/lib.go": "package lib\n\nfunc F(x int) int { return max(x, 1) }\n",
+	}); err != nil {
+		t.Fatalf("Failed to write files: %s", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %s", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to enter directory: %s: %s", dir, err)
+	}
+	defer os.Chdir(cwd)
+
+	testCases := []struct {
+		name string
+		opts *gottani.Options
+	}{
+		{"default", nil},
+		{"language version", &gottani.Options{GoVersion: "go1.21"}},
+		{"modules", &gottani.Options{Modules: true, GoVersion: "go1.21"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := gottani.CombineWithOptions("a", "main", tc.opts)
+			if err != nil {
+				t.Fatalf("Failed to Combine(): %s", err)
+			}
+			if !strings.Contains(string(got), "func F(x int) int") {
+				t.Errorf("Combined source lacks the library:\n%s", got)
+			}
+		})
+	}
+
+	// the main package read from stdin
+	stdin := filepath.Join(dir, "a", "stdin.go")
+	src := []byte("package main\n\nimport \"contest/lib\"\n\nfunc main() { println(lib.F(3)) }\n")
+	got, err := gottani.CombineFiles([]string{stdin}, "main", &gottani.Options{Overlay: map[string][]byte{stdin: src}})
+	if err != nil {
+		t.Fatalf("Failed to CombineFiles(): %s", err)
+	}
+	if !strings.Contains(string(got), "func F(x int) int") {
+		t.Errorf("Combined source lacks the library:\n%s", got)
+	}
+}
+
+func TestCombineWithOverlay(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeFiles(dir, map[string]string{
+		"go.mod":     "module example.com/app\n\ngo 1.23\n",
+		"main.go":    "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/lib\"\n)\n\nfunc main() { fmt.Println(lib.F()) }\n",
+		"lib/lib.go": "package lib\n\nfunc F() string { return \"disk\" }\n",
+	}); err != nil {
+		t.Fatalf("Failed to write files: %s", err)
+	}
+	overlay := map[string][]byte{
+		// modified file and a new one only in the overlay
+		filepath.Join(dir, "lib", "lib.go"):   []byte("package lib\n\nfunc F() string { return g() }\n"),
+		filepath.Join(dir, "lib", "added.go"): []byte("package lib\n\nfunc g() string { return \"overlay\" }\n"),
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %s", err)
+	}
+
+	testCases := []struct {
+		name string
+		opts *gottani.Options
+	}{
+		{"build", &gottani.Options{Overlay: overlay}},
+		{"modules", &gottani.Options{Overlay: overlay, Modules: true}},
+		{"cache", &gottani.Options{Overlay: overlay, CacheDir: t.TempDir()}},
+		{"parallel", &gottani.Options{Overlay: overlay, Parallel: true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.Chdir(dir); err != nil {
+				t.Fatalf("Failed to enter directory: %s: %s", dir, err)
+			}
+			defer os.Chdir(cwd)
+
+			src, err := gottani.CombineWithOptions(".", "main", tc.opts)
+			if err != nil {
+				t.Fatalf("Failed to Combine(): %s", err)
+			}
+			for _, want := range []string{"//line example.com/app/lib/lib.go:3", "//line example.com/app/lib/added.go:3"} {
+				if !bytes.Contains(src, []byte(want)) {
+					t.Errorf("Combined source doesn't contain %q:\n%s", want, src)
+				}
+			}
+			out, err := run(src)
+			if err != nil {
+				t.Fatalf("Failed to run combined source: %s", err)
+			}
+			if got := strings.TrimSpace(string(out)); got != "overlay" {
+				t.Errorf("Combined source printed %q, want %q", got, "overlay")
+			}
+		})
+	}
+
+	// the files on the disk are untouched
+	b, err := os.ReadFile(filepath.Join(dir, "lib", "lib.go"))
+	if err != nil || !bytes.Contains(b, []byte("disk")) {
+		t.Errorf("lib.go on the disk has been changed: %q, %v", b, err)
+	}
+}
+
+func TestCombineWithFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/go.mod":     {Data: []byte("module example.com/app\n\ngo 1.23\n")},
+		"app/main.go":    {Data: []byte("package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/lib\"\n\t\"example.com/other\"\n)\n\nfunc main() { fmt.Println(lib.F(), other.G()) }\n")},
+		"app/lib/lib.go": {Data: []byte("package lib\n\nimport \"strings\"\n\nfunc F() string { return strings.ToUpper(\"lib\") }\n")},
+		// GOPATH/src like layout
+		"example.com/other/other.go": {Data: []byte("package other\n\nfunc G() int { return 42 }\n")},
+	}
+
+	testCases := []struct {
+		name string
+		opts *gottani.Options
+	}{
+		{"build", &gottani.Options{FS: fsys}},
+		{"stdexport", &gottani.Options{FS: fsys, StdExportData: true}},
+		{"cache", &gottani.Options{FS: fsys, CacheDir: t.TempDir()}},
+		{"overlay", &gottani.Options{FS: fsys, Overlay: map[string][]byte{
+			"app/lib/lib.go": []byte("package lib\n\nfunc F() string { return \"LIB\" }\n"),
+		}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, err := gottani.CombineWithOptions("app", "main", tc.opts)
+			if err != nil {
+				t.Fatalf("Failed to Combine(): %s", err)
+			}
+			for _, want := range []string{"//line example.com/app/lib/lib.go:", "//line example.com/other/other.go:3"} {
+				if !bytes.Contains(src, []byte(want)) {
+					t.Errorf("Combined source doesn't contain %q:\n%s", want, src)
+				}
+			}
+			out, err := run(src)
+			if err != nil {
+				t.Fatalf("Failed to run combined source: %s", err)
+			}
+			if got, want := strings.TrimSpace(string(out)), "LIB 42"; got != want {
+				t.Errorf("Combined source printed %q, want %q", got, want)
+			}
+		})
+	}
+
+	if _, err := gottani.CombineWithOptions("app", "main", &gottani.Options{FS: fstest.MapFS{
+		"app/main.go": {Data: []byte("package main\n\nimport \"example.com/missing\"\n\nfunc main() { missing.F() }\n")},
+	}}); err == nil || !strings.Contains(err.Error(), `cannot find package "example.com/missing" in FS`) {
+		t.Errorf("Combine() returned %v for a missing package", err)
+	}
+}
+
+func TestCombineFiles(t *testing.T) {
+	dir := "testdata/files"
+	src, err := os.ReadFile(filepath.Join(dir, "src", "a.go"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %s", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %s", err)
+	}
+	stdin := filepath.Join(cwd, dir, "src", "stdin.go")
+
+	testCases := []struct {
+		name   string
+		files  []string
+		opts   *gottani.Options
+		golden string
+	}{
+		{"a.go", []string{"src/a.go"}, nil, "combined_a.go"},
+		{"b.go", []string{"src/b.go"}, nil, "combined_b.go"},
+		{"modules", []string{"src/a.go"}, &gottani.Options{Modules: true}, "combined_a.go"},
+		{"parallel", []string{"src/b.go"}, &gottani.Options{Parallel: true, StdExportData: true}, "combined_b.go"},
+		{"stdin", []string{stdin}, &gottani.Options{Overlay: map[string][]byte{stdin: src}}, "combined_a.go"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
 			if err := os.Chdir(dir); err != nil {
 				t.Fatalf("Failed to enter directory: %s: %s", dir, err)
 			}
-			wantSrcPath := "combined.go"
-			wantSrc, err := ioutil.ReadFile(wantSrcPath)
+			defer os.Chdir(cwd)
+
+			want, err := os.ReadFile(tc.golden)
+			if err != nil {
+				t.Fatalf("Failed to read file: %s", err)
+			}
+			got, err := gottani.CombineFiles(tc.files, "main", tc.opts)
 			if err != nil {
-				abs, err := filepath.Abs(wantSrcPath)
+				t.Fatalf("Failed to CombineFiles(): %s", err)
+			}
+			if tc.name == "stdin" {
+				want = bytes.ReplaceAll(want, []byte("//line a.go:"), []byte("//line stdin.go:"))
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Combined source is wrong: got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+
+	if _, err := gottani.CombineFiles([]string{"testdata/files/src/a.go", "testdata/files/lib/lib.go"}, "main", nil); err == nil {
+		t.Errorf("CombineFiles() succeeded for files in different directories")
+	}
+}
+
+func TestCombineIgnoresCombinedSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, os.DirFS("examples/05-renaming")); err != nil {
+		t.Fatalf("Failed to copy example: %s", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %s", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to enter directory: %s: %s", dir, err)
+	}
+	defer os.Chdir(cwd)
+
+	srcDir := "src"
+	want, err := gottani.Combine(srcDir, "main")
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+
+	// the result written in the package is not a part of it
+	if err := os.WriteFile(filepath.Join(srcDir, "submit.go"), want, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %s", err)
+	}
+	got, err := gottani.Combine(srcDir, "main")
+	if err != nil {
+		t.Fatalf("Failed to Combine() with the combined source: %s", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Combined source is changed: got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCombineWithLog(t *testing.T) {
+	log := new(bytes.Buffer)
+	_, err := gottani.CombineWithOptions("testdata/issue4/src", "main", &gottani.Options{Modules: true, Log: log})
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+	for _, want := range []string{"loaded ", "example.com/lib", "squashed in ", "formatted "} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("Log doesn't contain %q:\n%s", want, log)
+		}
+	}
+}
+
+func TestCombineSideEffects(t *testing.T) {
+	effects := new(bytes.Buffer)
+	got, err := gottani.CombineWithOptions("testdata/sideeffects/src", "main", &gottani.Options{Modules: true, SideEffects: effects})
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+	for _, s := range []string{`_ "embed"`, `var _ = Register("builtin")`, "var _ Shape = (*Square)(nil)", "var table = build()", `Register("plugin")`} {
+		if !strings.Contains(string(got), s) {
+			t.Errorf("Combined source lacks %q:\n%s", s, got)
+		}
+	}
+	for _, s := range []string{"unused", "Unused", "Big", "Pair"} {
+		if strings.Contains(string(got), s) {
+			t.Errorf("Combined source has unused %q:\n%s", s, got)
+		}
+	}
+
+	// the conversions are found in the packages restored from the cache
+	dir := t.TempDir()
+	for _, name := range []string{"cold", "warm"} {
+		res, err := gottani.CombineWithOptions("testdata/sideeffects/src", "main", &gottani.Options{Modules: true, CacheDir: dir})
+		if err != nil {
+			t.Fatalf("Failed to Combine() with the %s cache: %s", name, err)
+		}
+		if !bytes.Equal(res, got) {
+			t.Errorf("Combined source with the %s cache differs:\n%s", name, res)
+		}
+	}
+	if st, err := gottani.GetCacheStats(dir); err != nil || st.Packages == 0 {
+		t.Errorf("Cache isn't used: %+v, %v", st, err)
+	}
+	out, err := run(got)
+	if err != nil {
+		t.Fatalf("Failed to run combined source: %s", err)
+	}
+	if want := "building table\n[builtin plugin]\n"; string(out) != want {
+		t.Errorf("Combined source printed %q, want %q", out, want)
+	}
+
+	lines := strings.Split(strings.TrimSpace(effects.String()), "\n")
+	wants := []string{"lib.go:16:5: var _", "lib.go:30:5: var _", "lib.go:32:5: var table", `main.go:4:2: import _ "embed"`, "plugin.go:5:1: func init of blank-imported "}
+	if len(lines) != len(wants) {
+		t.Fatalf("SideEffects got %d lines, want %d:\n%s", len(lines), len(wants), effects)
+	}
+	for i, want := range wants {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("SideEffects line %d is %q, want %q", i, lines[i], want)
+		}
+	}
+}
+
+func TestCombineDeadBranches(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts gottani.Options
+	}{
+		{"default", gottani.Options{Modules: true}},
+		{"cache", gottani.Options{Modules: true, CacheDir: t.TempDir()}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := gottani.CombineWithOptions("testdata/deadcode/src", "main", &tc.opts)
+			if err != nil {
+				t.Fatalf("Failed to Combine(): %s", err)
+			}
+			if tc.opts.CacheDir != "" {
+				// the second run restores packages from the cache
+				got, err = gottani.CombineWithOptions("testdata/deadcode/src", "main", &tc.opts)
 				if err != nil {
-					abs = filepath.Join(cwd, dir, wantSrcPath)
+					t.Fatalf("Failed to Combine() again: %s", err)
+				}
+			}
+			for _, s := range []string{"dump", "slowRead", "modeOne", "modeOther", `"os"`, "case 1:", "v - 1", "v * 2"} {
+				if strings.Contains(string(got), s) {
+					t.Errorf("Combined source has dead code %q:\n%s", s, got)
+				}
+			}
+			// the branch jumping to the label is kept not to leave the label unused
+			for _, s := range []string{"_ = i", "_ = trace", "_ = w", "continue outer", "case v < 0:"} {
+				if !strings.Contains(string(got), s) {
+					t.Errorf("Combined source lacks %q:\n%s", s, got)
 				}
-				t.Fatalf("Failed to read file: %s: %s", abs, err)
 			}
+			out, err := run(got)
+			if err != nil {
+				t.Fatalf("Failed to run combined source: %s", err)
+			}
+			if want := "6 fast4 two true 3 false 5 4 negative\n"; string(out) != want {
+				t.Errorf("Combined source printed %q, want %q", out, want)
+			}
+		})
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	testCases := []struct {
+		dir, entry string
+		want       error
+	}{
+		{"testdata/no-such-dir", "main", gottani.ErrLoad},
+		{"testdata/issue4/src", "solve", nil},
+		{"examples/01-simple/src", "solve", gottani.ErrEntryPoint},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.dir+"/"+tc.entry, func(t *testing.T) {
+			_, err := gottani.Combine(tc.dir, tc.entry)
+			if err == nil {
+				t.Fatalf("Combine() succeeded unexpectedly")
+			}
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Errorf("Combine() returned %q, want %q", err, tc.want)
+			}
+			if errors.Is(err, gottani.ErrCombine) {
+				t.Errorf("Combine() returned an internal error: %s", err)
+			}
+		})
+	}
+}
+
+func TestCombineWithKeep(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts gottani.Options
+	}{
+		{"keep", gottani.Options{Modules: true, Keep: []string{"example.com/lib"}}},
+		{"pattern", gottani.Options{Modules: true, Keep: []string{"example.com/..."}}},
+		{"profile", gottani.Options{Modules: true, Profile: &gottani.Profile{Allowed: []string{"example.com/lib/..."}}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := gottani.CombineWithOptions("testdata/issue4/src", "main", &tc.opts)
+			if err != nil {
+				t.Fatalf("Failed to Combine(): %s", err)
+			}
+			for _, want := range []string{`"example.com/lib"`, "lib.F()"} {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("Combined source doesn't contain %s:\n%s", want, got)
+				}
+			}
+			if strings.Contains(string(got), "math") {
+				t.Errorf("Combined source contains the kept package:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestCombineWithInline(t *testing.T) {
+	inline := []string{"cmp", "iter", "maps", "slices"}
+	got, err := gottani.CombineWithOptions("testdata/inline/src", "main", &gottani.Options{Inline: inline})
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+	for _, path := range append(inline, "unsafe") {
+		if strings.Contains(string(got), strconv.Quote(path)) {
+			t.Errorf("Combined source imports %s:\n%s", path, got)
+		}
+	}
+	out, err := run(got)
+	if err != nil {
+		t.Fatalf("Failed to run combined source: %s", err)
+	}
+	if want := "[a b c] [3 2 1] 2 3\n"; string(out) != want {
+		t.Errorf("Combined source printed %q, want %q", out, want)
+	}
+
+	_, err = gottani.CombineWithOptions("testdata/inline/pull", "main", &gottani.Options{Inline: inline})
+	if !errors.Is(err, gottani.ErrLoad) || errors.Is(err, gottani.ErrCombine) || !strings.Contains(err.Error(), "internal/race") {
+		t.Errorf("Combine() returned %v, want an error of the internal package", err)
+	}
+
+	// the inlined packages are built by the Go of the judge
+	_, err = gottani.CombineWithOptions("testdata/inline/src", "main", &gottani.Options{Inline: inline, GoVersion: "go1.20"})
+	var serr scanner.Error
+	if !errors.As(err, &serr) || !strings.Contains(err.Error(), "go1.21") {
+		t.Errorf("Combine() returned %v, want an error of a feature later than go1.20", err)
+	}
+}
+
+func TestCombineGroupedSpecs(t *testing.T) {
+	got, err := gottani.CombineWithOptions("testdata/groups/src", "main", &gottani.Options{Modules: true})
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+	for _, name := range []string{"Ident", "identifier", "Op ", "KB", "MB", "Red", "Line", "Names", "Table"} {
+		if strings.Contains(string(got), name) {
+			t.Errorf("Combined source has unused %s:\n%s", name, got)
+		}
+	}
+	out, err := run(got)
+	if err != nil {
+		t.Fatalf("Failed to run combined source: %s", err)
+	}
+	if want := "Kind(2) Kind(3)\n1073741824 1099511627776\n2 5\n{{0 0} {1 2}}\n[2 3 5 7]\n"; string(out) != want {
+		t.Errorf("Combined source printed %q, want %q", out, want)
+	}
+}
 
-			// do Compbine()
-			srcDir := "src"
-			gotSrc, err := gottani.Combine(srcDir, "main")
+func TestCombineWithPruneMethods(t *testing.T) {
+	unused := []string{"Count()", "Reset()", "perimeter()", "sum()", "Unused()", "(s *seg) String()"}
+	testCases := []struct {
+		name string
+		opts gottani.Options
+		kept bool
+	}{
+		{"default", gottani.Options{Modules: true}, true},
+		{"prune", gottani.Options{Modules: true, PruneMethods: true}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := gottani.CombineWithOptions("testdata/rta/src", "main", &tc.opts)
 			if err != nil {
-				abs, erra := filepath.Abs(srcDir)
-				if erra != nil {
-					abs = filepath.Join(cwd, dir, srcDir)
+				t.Fatalf("Failed to Combine(): %s", err)
+			}
+			for _, m := range unused {
+				if strings.Contains(string(got), m) != tc.kept {
+					t.Errorf("Combined source has %s: %t, want %t:\n%s", m, !tc.kept, tc.kept, got)
 				}
-				t.Fatalf("Failed to Combine(): %s: %s", abs, err.Error())
 			}
+			out, err := run(got)
+			if err != nil {
+				t.Fatalf("Failed to run combined source: %s", err)
+			}
+			if want := "true false\n(4, 8)\n2\n6 2x3\nrect\n3\n[a bb ccc]\n[1 2 3]\n"; string(out) != want {
+				t.Errorf("Combined source printed %q, want %q", out, want)
+			}
+		})
+	}
+}
+
+func TestCombineWithPruneFields(t *testing.T) {
+	opts := &gottani.Options{Modules: true, PruneMethods: true, PruneFields: true}
+	got, err := gottani.CombineWithOptions("testdata/fields/src", "main", opts)
+	if err != nil {
+		t.Fatalf("Failed to Combine(): %s", err)
+	}
+	for _, s := range []string{"debug name", "cache", "hits", "label", "Z int", "sync.Mutex{}, 0, 0", "\"item\"", "title", "String()", "Title()"} {
+		if strings.Contains(string(got), s) {
+			t.Errorf("Combined source has unused %q:\n%s", s, got)
+		}
+	}
+	for _, s := range []string{"mu sync.Mutex", "note string", "a, b int", "weight(id)", "val T", "return size"} {
+		if !strings.Contains(string(got), s) {
+			t.Errorf("Combined source lacks %q:\n%s", s, got)
+		}
+	}
+	out, err := run(got)
+	if err != nil {
+		t.Fatalf("Failed to run combined source: %s", err)
+	}
+	if want := "3\n{1 2 }\n3\nweight 4\n4\n1\nbox\n1\n3\n"; string(out) != want {
+		t.Errorf("Combined source printed %q, want %q", out, want)
+	}
+}
+
+func TestCombinePruneWithCacheDir(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts gottani.Options
+	}{
+		{"methods", gottani.Options{Modules: true, PruneMethods: true, CacheDir: t.TempDir()}},
+		{"fields", gottani.Options{Modules: true, PruneFields: true, CacheDir: t.TempDir()}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := gottani.CombineWithOptions("testdata/fields/src", "main", &tc.opts)
+			if !errors.Is(err, gottani.ErrOptions) {
+				t.Errorf("Combine() returned %v, want %v", err, gottani.ErrOptions)
+			}
+			st, err := gottani.GetCacheStats(tc.opts.CacheDir)
+			if err != nil {
+				t.Fatalf("Failed to GetCacheStats(): %s", err)
+			}
+			if st != (gottani.CacheStats{}) {
+				t.Errorf("Entries are stored: %+v", st)
+			}
+		})
+	}
+}
+
+func TestCombineWithReplace(t *testing.T) {
+	const fastio = "github.com/ktateish/gottani/testdata/replace/fastio"
+	testCases := []struct {
+		name string
+		opts gottani.Options
+	}{
+		{"sequential", gottani.Options{}},
+		{"modules", gottani.Options{Modules: true}},
+		{"parallel", gottani.Options{Parallel: true}},
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %s", err)
+	}
+	dir := filepath.Join(cwd, "testdata", "replace")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.Chdir(dir); err != nil {
+				t.Fatalf("Failed to enter directory: %s: %s", dir, err)
+			}
+			defer os.Chdir(cwd)
 
-			gotResult, err := run(gotSrc)
+			opts := tc.opts
+			opts.Replace = map[string]string{fastio: fastio + "_judge"}
+			got, err := gottani.CombineWithOptions("src", "main", &opts)
+			if err != nil {
+				t.Fatalf("Failed to Combine(): %s", err)
+			}
+			out, err := run(got)
 			if err != nil {
-				t.Fatalf("Failed to run combined source: %s", err.Error())
+				t.Fatalf("Failed to run combined source: %s", err)
+			}
+			if want := "judge: hello\n"; string(out) != want {
+				t.Errorf("Combined source printed %q, want %q", out, want)
+			}
+
+			opts.Replace = map[string]string{fastio: fastio + "_bad"}
+			_, err = gottani.CombineWithOptions("src", "main", &opts)
+			for _, want := range []string{"Writer.Flush is missing", "Writer.WriteString is"} {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Combine() returned %v, want an error containing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCombineWithProfile(t *testing.T) {
+	testCases := []struct {
+		profile gottani.Profile
+		want    string
+	}{
+		{gottani.Profile{Name: "ok", MaxSize: 4096}, ""},
+		{gottani.Profile{Name: "small", MaxSize: 100}, "exceeds the limit 100 bytes"},
+		{gottani.Profile{Name: "nofmt", Forbidden: []string{"fmt"}}, `package "fmt" is forbidden`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.profile.Name, func(t *testing.T) {
+			_, err := gottani.CombineWithOptions("examples/01-simple/src", "main", &gottani.Options{Profile: &tc.profile})
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("Failed to Combine(): %s", err)
+				}
+				return
 			}
+			if !errors.Is(err, gottani.ErrProfile) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Combine() returned %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	p := gottani.Profiles["atcoder"]
+	src := "package main\n\nimport (\n\t\"fmt\"\n\n\t\"gonum.org/v1/gonum/mat\"\n)\n"
+	if err := p.Validate([]byte(src)); err != nil {
+		t.Errorf("Validate() failed for an allowed package: %s", err)
+	}
+	for _, path := range []string{"example.com/lib", "contest/lib"} {
+		src = "package main\n\nimport \"" + path + "\"\n"
+		if err := p.Validate([]byte(src)); !errors.Is(err, gottani.ErrProfile) {
+			t.Errorf("Validate() returned %v for a package %s not provided", err, path)
+		}
+	}
+}
 
-			wantResult, err := run(wantSrc)
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "abc350", "a")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatalf("Failed to create dir: %s", err)
+	}
+	testCases := []struct {
+		name, content string
+	}{
+		{".gottani.toml", "entry = \"solve\"\ntags = [\"judge\"]\ngo = \"go1.20\"\ncache = \"cache\"\n"},
+		{".gottani.json", `{"entry": "solve", "tags": ["judge"], "go": "go1.20", "cache": "cache"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name)
+			if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+				t.Fatalf("Failed to write file: %s", err)
+			}
+			defer os.Remove(path)
+
+			found, err := gottani.FindConfig(sub)
+			if err != nil {
+				t.Fatalf("Failed to FindConfig(): %s", err)
+			}
+			if found != path {
+				t.Fatalf("FindConfig() returned %q, want %q", found, path)
+			}
+			cfg, err := gottani.LoadConfig(found)
 			if err != nil {
-				t.Fatalf("Failed to run the properly combined source: %s", err.Error())
+				t.Fatalf("Failed to LoadConfig(): %s", err)
+			}
+			want := &gottani.Config{
+				Options: gottani.Options{
+					BuildTags: []string{"judge"},
+					GoVersion: "go1.20",
+					CacheDir:  filepath.Join(dir, "cache"),
+				},
+				Entry: "solve",
+				Path:  path,
+			}
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("LoadConfig() returned %+v, want %+v", cfg, want)
 			}
+		})
+	}
+
+	path := filepath.Join(dir, ".gottani.toml")
+	if err := os.WriteFile(path, []byte("entry = \"solve\"\nunknown = 1\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %s", err)
+	}
+	if _, err := gottani.LoadConfig(path); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("LoadConfig() returned %v, want an error of the unknown key", err)
+	}
+}
+
+func TestCombinerWatch(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, os.DirFS("examples/05-renaming")); err != nil {
+		t.Fatalf("Failed to copy example: %s", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %s", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to enter directory: %s: %s", dir, err)
+	}
+	defer os.Chdir(cwd)
+
+	type result struct {
+		src []byte
+		err error
+	}
+	results := make(chan result)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		c := gottani.NewCombiner(nil)
+		done <- c.Watch(ctx, "src", "main", 10*time.Millisecond, func(src []byte, err error) {
+			results <- result{src, err}
+		})
+	}()
+	next := func() result {
+		t.Helper()
+		select {
+		case res := <-results:
+			return res
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Watch() didn't combine the application")
+		}
+		return result{}
+	}
+	libPath := filepath.Join("lib", "lib.go")
+	lib, err := os.ReadFile(libPath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %s", err)
+	}
+
+	if res := next(); res.err != nil || !bytes.Contains(res.src, []byte(`"This is lib.VarX"`)) {
+		t.Fatalf("Watch() combined wrongly at first: %s\n%s", res.err, res.src)
+	}
+
+	// changing a library
+	changed := bytes.Replace(lib, []byte(`"This is lib.VarX"`), []byte(`"This is the changed lib.VarX"`), 1)
+	if err := os.WriteFile(libPath, changed, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %s", err)
+	}
+	if res := next(); res.err != nil || !bytes.Contains(res.src, []byte(`"This is the changed lib.VarX"`)) {
+		t.Fatalf("Watch() didn't combine the changed library: %s\n%s", res.err, res.src)
+	}
+
+	// breaking and fixing it
+	if err := os.WriteFile(libPath, append(changed, "var broken int = \"\"\n"...), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %s", err)
+	}
+	if res := next(); res.err == nil || !strings.Contains(res.err.Error(), filepath.Join(dir, libPath)) {
+		t.Fatalf("Watch() returned %v for the broken library", res.err)
+	}
+	if err := os.WriteFile(libPath, lib, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %s", err)
+	}
+	if res := next(); res.err != nil || !bytes.Contains(res.src, []byte(`"This is lib.VarX"`)) {
+		t.Fatalf("Watch() didn't combine the fixed library: %s\n%s", res.err, res.src)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Watch() returned %v after canceled", err)
+	}
+}
 
-			// check the exec result
-			if !reflect.DeepEqual(gotResult, wantResult) {
-				t.Fatalf("Result of running the combined source is wrong: %s", dir)
+func BenchmarkCombine(b *testing.B) {
+	for _, n := range []int{100, 1000, 3000} {
+		b.Run(fmt.Sprintf("types=%d", n), func(b *testing.B) {
+			dir := b.TempDir()
+			if err := generateLibrary(dir, n); err != nil {
+				b.Fatalf("Failed to generate library: %s", err)
 			}
+			srcDir := filepath.Join(dir, "src")
+			cwd, err := os.Getwd()
+			if err != nil {
+				b.Fatalf("Failed to get working dir: %s", err)
+			}
+			if err := os.Chdir(srcDir); err != nil {
+				b.Fatalf("Failed to enter directory: %s: %s", srcDir, err)
+			}
+			defer os.Chdir(cwd)
 
-			// check the combined source code
-			if !reflect.DeepEqual(gotSrc, wantSrc) {
-				t.Fatalf("Combined source is wrong: %s", dir)
+			// packages are loaded once so that it measures combining
+			c := gottani.NewCombiner(&gottani.Options{StdExportData: true})
+			if _, err := c.Combine(srcDir, "main"); err != nil {
+				b.Fatalf("Failed to Combine(): %s", err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Combine(srcDir, "main"); err != nil {
+					b.Fatalf("Failed to Combine(): %s", err)
+				}
 			}
 		})
 	}
 }
 
+// generateLibrary generates an application using a library that has n types
+// with methods and functions (about 20 lines for each) in 10 files.  The
+// application uses a half of them.
+func generateLibrary(dir string, n int) error {
+	files := map[string]string{
+		"lib/go.mod": "module example.com/lib\n\ngo 1.23\n",
+		"src/go.mod": "module example.com/app\n\ngo 1.23\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ../lib\n",
+	}
+	var main strings.Builder
+	main.WriteString("package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/lib\"\n)\n\nfunc main() {\n")
+	for f := 0; f < 10; f++ {
+		var lib strings.Builder
+		fmt.Fprintf(&lib, "package lib\n\nimport \"fmt\"\n")
+		for i := f * n / 10; i < (f+1)*n/10; i++ {
+			fmt.Fprintf(&lib, `
+type T%[1]d struct {
+	a, b int
+	s    []string
+}
+
+func (t *T%[1]d) M(x int) int {
+	s := 0
+	for i := 0; i < x; i++ {
+		s += i * t.a
+	}
+	t.s = append(t.s, fmt.Sprint(s))
+	return s + helper%[1]d(t.b)
+}
+
+func helper%[1]d(v int) int { return v * %[1]d }
+
+func F%[1]d(x int) int { return (&T%[1]d{a: x}).M(x) }
+`, i)
+			if i%2 == 0 {
+				fmt.Fprintf(&main, "\tfmt.Println(lib.F%d(%d))\n", i, i)
+			}
+		}
+		files[fmt.Sprintf("lib/lib%d.go", f)] = lib.String()
+	}
+	main.WriteString("}\n")
+	files["src/main.go"] = main.String()
+
+	return writeFiles(dir, files)
+}
+
+// generatePackages generates an application using n leaf packages and a
+// package importing all of them.  Each leaf package has m types.
+func generatePackages(dir string, n, m int) error {
+	files := map[string]string{
+		"lib/go.mod": "module example.com/lib\n\ngo 1.23\n",
+		"src/go.mod": "module example.com/app\n\ngo 1.23\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ../lib\n",
+	}
+	var all strings.Builder
+	all.WriteString("package all\n\nimport (\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&all, "\t\"example.com/lib/leaf%d\"\n", i)
+	}
+	all.WriteString(")\n\nfunc Sum(x int) int {\n\ts := 0\n")
+	for i := 0; i < n; i++ {
+		var leaf strings.Builder
+		fmt.Fprintf(&leaf, "package leaf%d\n\nimport \"strconv\"\n", i)
+		for j := 0; j < m; j++ {
+			fmt.Fprintf(&leaf, `
+type T%[1]d struct{ v int }
+
+func (t T%[1]d) String() string { return strconv.Itoa(t.v + %[1]d) }
+
+func F%[1]d(x int) string { return T%[1]d{x}.String() }
+`, j)
+		}
+		files[fmt.Sprintf("lib/leaf%d/leaf.go", i)] = leaf.String()
+		fmt.Fprintf(&all, "\ts += len(leaf%d.F%d(x))\n", i, i%m)
+	}
+	all.WriteString("\treturn s\n}\n")
+	files["lib/all/all.go"] = all.String()
+	files["src/main.go"] = "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/lib/all\"\n)\n\nfunc main() {\n\tfmt.Println(all.Sum(42))\n}\n"
+
+	return writeFiles(dir, files)
+}
+
+// writeFiles writes the files given as mapping from the relative paths to their contents.
+func writeFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func testCombine(t *testing.T, cwd, dir string, opts *gottani.Options) {
+	t.Helper()
+
+	// reset to cwd
+	if err := os.Chdir(cwd); err != nil {
+		t.Fatalf("Failed to enter directory: %s: %s", cwd, err)
+	}
+	defer os.Chdir(cwd)
+
+	// prepare want result
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to enter directory: %s: %s", dir, err)
+	}
+	wantSrcPath := "combined.go"
+	wantSrc, err := ioutil.ReadFile(wantSrcPath)
+	if err != nil {
+		abs, err := filepath.Abs(wantSrcPath)
+		if err != nil {
+			abs = filepath.Join(cwd, dir, wantSrcPath)
+		}
+		t.Fatalf("Failed to read file: %s: %s", abs, err)
+	}
+
+	// do Compbine()
+	srcDir := "src"
+	gotSrc, err := gottani.CombineWithOptions(srcDir, "main", opts)
+	if err != nil {
+		abs, erra := filepath.Abs(srcDir)
+		if erra != nil {
+			abs = filepath.Join(cwd, dir, srcDir)
+		}
+		t.Fatalf("Failed to Combine(): %s: %s", abs, err.Error())
+	}
+
+	gotResult, err := run(gotSrc)
+	if err != nil {
+		t.Fatalf("Failed to run combined source: %s", err.Error())
+	}
+
+	wantResult, err := run(wantSrc)
+	if err != nil {
+		t.Fatalf("Failed to run the properly combined source: %s", err.Error())
+	}
+
+	// check the exec result
+	if !reflect.DeepEqual(gotResult, wantResult) {
+		t.Fatalf("Result of running the combined source is wrong: %s", dir)
+	}
+
+	// check the combined source code
+	if !reflect.DeepEqual(gotSrc, wantSrc) {
+		t.Fatalf("Combined source is wrong: %s", dir)
+	}
+}
+
 func compile(src []byte) (string, error) {
 	sf, err := ioutil.TempFile("", "gottani-test-combined-*.go")
 	if err != nil {
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ktateish/gottani"
+)
+
+// isPattern reports whether the arg is a pattern like ./abc350/... matching
+// packages under a directory
+func isPattern(arg string) bool {
+	return arg == "..." || strings.HasSuffix(arg, "/...")
+}
+
+// expandPatterns returns the directories of the main packages given as the
+// args.  A pattern matches all main packages under its directory except ones
+// ignored by the go command, i.e. vendor, testdata and directories starting
+// with "." or "_".  Other args are directories as is.  The files of packages
+// are selected with the ctxt of the target.
+func expandPatterns(ctxt *build.Context, args []string) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, arg := range args {
+		if !isPattern(arg) {
+			add(filepath.Clean(arg))
+			continue
+		}
+		root := filepath.Clean(strings.TrimSuffix(arg, "..."))
+		n := len(dirs)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			if name := d.Name(); path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			bp, err := ctxt.ImportDir(path, build.ImportComment)
+			if err != nil {
+				var noGo *build.NoGoError
+				if errors.As(err, &noGo) {
+					return nil
+				}
+				// it will be reported on combining
+				add(path)
+				return nil
+			}
+			if bp.Name == "main" {
+				add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("expanding %s: %w", arg, err)
+		}
+		if len(dirs) == n {
+			return nil, fmt.Errorf("%s matched no main packages", arg)
+		}
+	}
+	return dirs, nil
+}
+
+// outputPath returns the path given by the tmpl for the package in the dir.
+// {{dir}} and {{name}} in the tmpl are replaced with the dir and its base name.
+func outputPath(tmpl, dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	return strings.NewReplacer("{{dir}}", dir, "{{name}}", filepath.Base(abs)).Replace(tmpl)
+}
+
+// batch combines the main packages in the dirs with c from the entry point
+// and writes each result to the path given by the tmpl.  Then it prints the
+// summary to w, and the errors to stderr.
+func batch(c *gottani.Combiner, dirs []string, entry, tmpl string, w io.Writer) error {
+	type result struct {
+		dir, output string
+		size        int
+		err         error
+	}
+	var results []result
+	var errs []error
+	for _, dir := range dirs {
+		res := result{dir: dir, output: outputPath(tmpl, dir)}
+		b, err := c.Combine(dir, entry)
+		if err == nil {
+			err = writeFile(res.output, b)
+		}
+		if err != nil {
+			res.err = err
+			errs = append(errs, err)
+		} else {
+			res.size = len(b)
+		}
+		results = append(results, res)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tOUTPUT\tSIZE")
+	for _, res := range results {
+		if res.err != nil {
+			fmt.Fprintf(tw, "%s\t%s\tFAILED\n", res.dir, res.output)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", res.dir, res.output, res.size)
+		}
+	}
+	tw.Flush()
+	for _, res := range results {
+		if res.err != nil {
+			fmt.Fprintf(os.Stderr, "\n%s: %s\n", res.dir, res.err)
+		}
+	}
+
+	if 0 < len(errs) {
+		return batchError{errs: errs, total: len(results)}
+	}
+	return nil
+}
+
+// batchError is the error of the failed packages in batch.  It wraps all of
+// them so that the exit code reflects the most severe one.
+type batchError struct {
+	errs  []error
+	total int
+}
+
+func (e batchError) Error() string {
+	return fmt.Sprintf("%d of %d packages failed", len(e.errs), e.total)
+}
+
+func (e batchError) Unwrap() []error { return e.errs }
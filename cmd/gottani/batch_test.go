@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"go/build"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ktateish/gottani"
+)
+
+func TestExpandPatterns(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeFiles(dir, map[string]string{
+		"go.mod":                  "module contest\n\ngo 1.21\n",
+		"a/main.go":               "package main\n\nfunc main() {}\n",
+		"b/main.go":               "package main\n\nfunc main() {}\n",
+		"b/c/main.go":             "package main\n\nfunc main() {}\n",
+		"broken/main.go":          "package main\n\nfunc main() {\n",
+		"lib/lib.go":              "package lib\n",
+		"linux/main.go":           "//go:build linux\n\npackage main\n\nfunc main() {}\n",
+		"testdata/x/main.go":      "package main\n\nfunc main() {}\n",
+		"vendor/example.com/x.go": "package main\n\nfunc main() {}\n",
+		"_old/main.go":            "package main\n\nfunc main() {}\n",
+		".hidden/main.go":         "package main\n\nfunc main() {}\n",
+	}); err != nil {
+		t.Fatalf("Failed to write files: %s", err)
+	}
+	linux := build.Default
+	linux.GOOS = "linux"
+	windows := build.Default
+	windows.GOOS = "windows"
+	path := func(rel string) string { return filepath.Join(dir, rel) }
+
+	testCases := []struct {
+		name string
+		ctxt *build.Context
+		args []string
+		want []string
+	}{
+		{"pattern", &linux, []string{dir + "/..."}, []string{path("a"), path("b"), path("b/c"), path("broken"), path("linux")}},
+		{"target", &windows, []string{dir + "/..."}, []string{path("a"), path("b"), path("b/c"), path("broken")}},
+		{"subdir", &linux, []string{path("b") + "/..."}, []string{path("b"), path("b/c")}},
+		{"dirs", &linux, []string{path("a"), path("lib"), path("a") + "/"}, []string{path("a"), path("lib")}},
+		{"mixed", &linux, []string{path("b"), path("b") + "/..."}, []string{path("b"), path("b/c")}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := expandPatterns(tc.ctxt, tc.args)
+			if err != nil {
+				t.Fatalf("Failed to expandPatterns(): %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expandPatterns() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	for _, arg := range []string{path("lib") + "/...", path("none") + "/..."} {
+		if got, err := expandPatterns(&linux, []string{arg}); err == nil {
+			t.Errorf("expandPatterns(%q) = %q, want an error", arg, got)
+		}
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %s", err)
+	}
+	testCases := []struct {
+		tmpl, dir, want string
+	}{
+		{"submit.go", "abc350/a", "submit.go"},
+		{"{{dir}}/submit.go", "abc350/a", "abc350/a/submit.go"},
+		{"out/{{name}}.go", "abc350/a", "out/a.go"},
+		{"{{dir}}/{{name}}_submit.go", "./abc350/b", "./abc350/b/b_submit.go"},
+		{"{{name}}.go", ".", filepath.Base(cwd) + ".go"},
+	}
+	for _, tc := range testCases {
+		if got := outputPath(tc.tmpl, tc.dir); got != tc.want {
+			t.Errorf("outputPath(%q, %q) = %q, want %q", tc.tmpl, tc.dir, got, tc.want)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeFiles(dir, map[string]string{
+		"go.mod":     "module contest\n\ngo 1.21\n",
+		"a/main.go":  "package main\n\nimport \"contest/lib\"\n\nfunc main() { println(lib.F(2)) }\n",
+		"b/main.go":  "package main\n\nfunc main() { println(undefined) }\n",
+		"c/main.go":  "package main\n\nfunc main() { println(3) }\n",
+		"lib/lib.go": "package lib\n\nfunc F(x int) int { return x * 2 }\n",
+	}); err != nil {
+		t.Fatalf("Failed to write files: %s", err)
+	}
+	chdir(t, dir)
+
+	c := gottani.NewCombiner(nil)
+	dirs, err := expandPatterns(c.BuildContext(), []string{"./..."})
+	if err != nil {
+		t.Fatalf("Failed to expandPatterns(): %s", err)
+	}
+	var w bytes.Buffer
+	err = batch(c, dirs, "main", "{{dir}}/submit.go", &w)
+
+	// the failure of b doesn't stop the others
+	var berr batchError
+	if !errors.As(err, &berr) || len(berr.errs) != 1 || berr.total != 3 {
+		t.Fatalf("batch() returned %v, want 1 of 3 packages failed", err)
+	}
+	if got := exitCode(err); got != exitSourceError {
+		t.Errorf("exitCode() = %d, want %d", got, exitSourceError)
+	}
+	if got := errorMessage(err); !strings.HasSuffix(got, ": Error: 1 of 3 packages failed") {
+		t.Errorf("errorMessage() = %q, want the summary of the failures", got)
+	}
+	var summary [][]string
+	for _, line := range strings.Split(strings.TrimSpace(w.String()), "\n") {
+		summary = append(summary, strings.Fields(line))
+	}
+	want := [][]string{
+		{"PACKAGE", "OUTPUT", "SIZE"},
+		{"a", filepath.Join("a", "submit.go"), ""},
+		{"b", filepath.Join("b", "submit.go"), "FAILED"},
+		{"c", filepath.Join("c", "submit.go"), ""},
+	}
+	for _, row := range want {
+		if row[2] != "" {
+			continue
+		}
+		b, err := os.ReadFile(row[1])
+		if err != nil {
+			t.Fatalf("Failed to read the output: %s", err)
+		}
+		row[2] = strconv.Itoa(len(b))
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("Summary is %q, want %q", summary, want)
+	}
+	if _, err := os.Stat(filepath.Join("b", "submit.go")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Output of the failed package exists: %v", err)
+	}
+
+	// outputs combined before are not read as a part of the packages
+	w.Reset()
+	if err := batch(c, []string{"a", "c"}, "main", "{{dir}}/submit.go", &w); err != nil {
+		t.Errorf("batch() failed again: %s", err)
+	}
+}
+
+// chdir changes the current directory to the dir until the end of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %s", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to enter directory: %s: %s", dir, err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+}
+
+// writeFiles writes the files given as mapping from the relative paths to their contents.
+func writeFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,49 +1,443 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"go/scanner"
 	"go/types"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/ktateish/gottani"
 )
 
+// Exit codes of the command.  2 is left for the Go runtime, which exits with
+// it on an unrecovered panic.
+const (
+	exitError       = 1 // other errors, e.g. writing the output
+	exitSourceError = 3 // type or syntax errors in the Go source
+	exitLoadError   = 4 // errors in finding or reading packages
+	exitInternal    = 5 // errors in combining loaded packages, i.e. bugs
+	exitProfile     = 6 // the result violates the judge profile
+	exitUsage       = 7 // invalid flags or arguments
+	exitEntryPoint  = 8 // the entry point function is not found
+)
+
 func main() {
 	if err := Main(os.Args[1:]); err != nil {
-		var goError error
-		var foundGoError bool
-	outer:
-		for tmp := err; tmp != nil; tmp = errors.Unwrap(tmp) {
-			switch tmp.(type) {
-			case types.Error, scanner.ErrorList:
-				goError = tmp
-				foundGoError = true
-				break outer
-			}
-		}
-		if foundGoError {
-			fmt.Fprintf(os.Stderr, "%s\n", goError)
-		} else {
-			fmt.Fprintf(os.Stderr, "%s: Error: %s\n", os.Args[0], err)
+		fmt.Fprintln(os.Stderr, errorMessage(err))
+		os.Exit(exitCode(err))
+	}
+}
+
+// errorMessage returns the message for the err.  It is the error in the Go
+// source itself if the err is caused by it.
+func errorMessage(err error) string {
+	if serr := sourceError(err); serr != nil {
+		if _, ok := err.(batchError); !ok {
+			return serr.Error()
 		}
-		os.Exit(1)
+	}
+	return fmt.Sprintf("%s: Error: %s", os.Args[0], err)
+}
+
+// sourceError returns the error in the Go source which causes the err, or
+// nil if there is no such error
+func sourceError(err error) error {
+	var terr types.Error
+	var serr scanner.Error
+	var slerr scanner.ErrorList
+	switch {
+	case errors.As(err, &terr):
+		return terr
+	case errors.As(err, &serr):
+		return serr
+	case errors.As(err, &slerr):
+		return slerr
+	}
+	return nil
+}
+
+// usageError is an error in the flags or the arguments
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// exitCode returns the exit code for the err.  The most severe one is chosen
+// if the err consists of multiple errors.
+func exitCode(err error) int {
+	var uerr usageError
+	switch {
+	case errors.Is(err, gottani.ErrCombine):
+		return exitInternal
+	case sourceError(err) != nil:
+		return exitSourceError
+	case errors.Is(err, gottani.ErrLoad):
+		return exitLoadError
+	case errors.Is(err, gottani.ErrEntryPoint):
+		return exitEntryPoint
+	case errors.Is(err, gottani.ErrProfile):
+		return exitProfile
+	case errors.As(err, &uerr), errors.Is(err, gottani.ErrOptions):
+		return exitUsage
+	default:
+		return exitError
 	}
 }
 
+// stdinFile is the file name of the source read from stdin
+const stdinFile = "stdin.go"
+
+// watchInterval is the interval of polling the sources on -watch
+const watchInterval = 500 * time.Millisecond
+
 func Main(args []string) error {
-	var path string
-	if len(args) == 0 {
-		path = "."
-	} else {
-		path = args[0]
+	if 0 < len(args) && args[0] == "cache" {
+		return cacheMain(args[1:])
+	}
+	showConfig := 0 < len(args) && args[0] == "config"
+	if showConfig {
+		args = args[1:]
+	}
+
+	// The flags are parsed twice: first to find the config file from the
+	// root package, then with the defaults read from it.  Errors are
+	// reported by the second one.
+	cfg := &gottani.Config{}
+	var fl cliFlags
+	fs := newFlagSet(cfg, &fl)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err == nil {
+		path := fl.config
+		if path == "" {
+			var err error
+			path, err = gottani.FindConfig(configDir(fs.Args()))
+			if err != nil {
+				return err
+			}
+		}
+		if path != "" {
+			if cfg, err = gottani.LoadConfig(path); err != nil {
+				return usageError{err}
+			}
+		}
+	}
+	if cfg.Entry == "" {
+		cfg.Entry = "main"
+	}
+	fl = cliFlags{}
+	fs = newFlagSet(cfg, &fl)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return usageError{err}
+	}
+	args = fs.Args()
+	if cfg.CacheDir == "" && !cfg.PruneMethods && !cfg.PruneFields {
+		// the cache given by the environment is left for the other runs
+		cfg.CacheDir = os.Getenv("GOTTANICACHE")
+	}
+	if err := cfg.ResolveProfile(); err != nil {
+		return usageError{err}
+	}
+	if showConfig {
+		return printConfig(os.Stdout, cfg)
+	}
+	if fl.verbose && fl.quiet {
+		return usageError{errors.New("-v and -q are exclusive")}
+	}
+	opts := cfg.Options
+	if fl.verbose {
+		opts.Log = os.Stderr
+	}
+	if fl.sideEffects {
+		opts.SideEffects = os.Stderr
+	}
+	var log io.Writer = os.Stderr
+	if fl.quiet {
+		log = io.Discard
+	}
+
+	multi := 1 < len(args) && !strings.HasSuffix(args[0], ".go")
+	for _, arg := range args {
+		multi = multi || isPattern(arg)
+	}
+	if fl.watch {
+		if cfg.Output == "" {
+			return usageError{errors.New("-watch requires -o")}
+		}
+		if multi || 0 < len(args) && args[0] == "-" {
+			return usageError{errors.New("-watch accepts only a directory or files")}
+		}
+		return watchMain(gottani.NewCombiner(&opts), args, cfg.Entry, cfg.Output, log)
+	}
+	if multi {
+		if cfg.Output == "" {
+			return usageError{errors.New("-o is required for multiple packages")}
+		}
+		c := gottani.NewCombiner(&opts)
+		dirs, err := expandPatterns(c.BuildContext(), args)
+		if err != nil {
+			return usageError{err}
+		}
+		return batch(c, dirs, cfg.Entry, cfg.Output, log)
+	}
+
+	var b []byte
+	var dir string
+	var err error
+	switch {
+	case len(args) == 1 && args[0] == "-":
+		// the main package is the source read from stdin as if it is in
+		// the current directory
+		src, rerr := io.ReadAll(os.Stdin)
+		if rerr != nil {
+			return fmt.Errorf("reading stdin: %w", rerr)
+		}
+		cwd, werr := os.Getwd()
+		if werr != nil {
+			return werr
+		}
+		path := filepath.Join(cwd, stdinFile)
+		opts.Overlay = map[string][]byte{path: src}
+		dir = "."
+		b, err = gottani.CombineFiles([]string{path}, cfg.Entry, &opts)
+	case 0 < len(args) && strings.HasSuffix(args[0], ".go"):
+		dir = filepath.Dir(args[0])
+		b, err = gottani.CombineFiles(args, cfg.Entry, &opts)
+	default:
+		dir = "."
+		if 0 < len(args) {
+			dir = args[0]
+		}
+		b, err = gottani.CombineWithOptions(dir, cfg.Entry, &opts)
+	}
+	if err != nil {
+		return err
 	}
+	if cfg.Output == "" || cfg.Output == "-" {
+		os.Stdout.Write(b)
+		return nil
+	}
+	return writeFile(outputPath(cfg.Output, dir), b)
+}
 
-	b, err := gottani.Combine(path, "main")
+// writeFile writes the data to the file atomically: the file is replaced
+// by a temporary file fully written in the same directory, so that it is
+// never left half-written.
+func writeFile(path string, data []byte) error {
+	// the temporary file doesn't end with .go not to be a part of the package
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	os.Stdout.Write(b)
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
 	return nil
 }
+
+// cliFlags are the flags of the command which are not in gottani.Config
+type cliFlags struct {
+	config      string
+	watch       bool
+	verbose     bool
+	quiet       bool
+	sideEffects bool
+}
+
+// newFlagSet creates the flag set of the command storing the values to the
+// cfg and the fl.  The values in the cfg are the defaults.
+func newFlagSet(cfg *gottani.Config, fl *cliFlags) *flag.FlagSet {
+	opts := &cfg.Options
+	fs := flag.NewFlagSet("gottani", flag.ContinueOnError)
+	fs.StringVar(&fl.config, "config", "", "read the config `file` instead of "+strings.Join(gottani.ConfigFiles, " or ")+" found in the directory of the package or its parents")
+	fs.BoolVar(&fl.watch, "watch", false, "combine again whenever the sources are changed until interrupted; requires -o")
+	fs.BoolVar(&fl.verbose, "v", false, "report the loaded packages and the time taken by each phase to stderr")
+	fs.BoolVar(&fl.quiet, "q", false, "report nothing but errors")
+	fs.BoolVar(&fl.sideEffects, "sideeffects", false, "list the initializers, init functions and blank imports kept for their side effects to stderr")
+	fs.StringVar(&cfg.Output, "o", cfg.Output, "write the result to the `file` instead of stdout (- for stdout); {{dir}} and {{name}} in it are replaced with the directory of the package and its base name")
+	fs.StringVar(&cfg.Entry, "entry", cfg.Entry, "the `name` of the entry point function")
+	fs.StringVar(&cfg.Judge, "judge", cfg.Judge, "validate the result against the judge `profile` defined in the config file or bundled ("+strings.Join(gottani.ProfileNames(), ", ")+"); it also gives the default of -go")
+	fs.BoolVar(&opts.Modules, "modules", opts.Modules, "resolve imports through the go command (go.work, replace directives and module cache)")
+	fs.BoolVar(&opts.Vendor, "vendor", opts.Vendor, "resolve imports from the vendor directory of the main module like go build -mod=vendor")
+	fs.BoolVar(&opts.StdExportData, "stdexport", opts.StdExportData, "import standard packages from compiled export data instead of their source")
+	fs.BoolVar(&opts.Parallel, "parallel", opts.Parallel, "parse and type-check independent packages in parallel")
+	fs.StringVar(&opts.CacheDir, "cache", opts.CacheDir, "keep type-checked packages in the `dir` across runs (default: $GOTTANICACHE, disabled if empty)")
+	fs.StringVar(&opts.GOROOT, "goroot", opts.GOROOT, "type-check against the standard packages in the Go tree at `dir` (e.g. the judge's version)")
+	fs.StringVar(&opts.GoVersion, "go", opts.GoVersion, "reject language features later than the Go `version` such as go1.20 (default: the version of -goroot if given)")
+	fs.StringVar(&opts.GOOS, "goos", opts.GOOS, "target `GOOS` (default: host)")
+	fs.StringVar(&opts.GOARCH, "goarch", opts.GOARCH, "target `GOARCH` (default: host)")
+	fs.Func("tags", "comma-separated list of additional build `tags`", func(s string) error {
+		opts.BuildTags = splitList(s)
+		return nil
+	})
+	fs.Func("keep", "comma-separated list of import path `patterns` (like example.com/lib/...) of packages kept as imports instead of being combined", func(s string) error {
+		opts.Keep = splitList(s)
+		return nil
+	})
+	fs.Func("inline", "comma-separated list of import path `patterns` of standard packages combined like non-standard ones (e.g. slices,maps for an older judge)", func(s string) error {
+		opts.Inline = splitList(s)
+		return nil
+	})
+	fs.Func("replace", "use the package of the import path new instead of old given as `old=new`; can be repeated", func(s string) error {
+		old, new, ok := strings.Cut(s, "=")
+		if !ok || old == "" || new == "" {
+			return errors.New("must be old=new")
+		}
+		if opts.Replace == nil {
+			opts.Replace = make(map[string]string)
+		}
+		opts.Replace[old] = new
+		return nil
+	})
+	fs.BoolVar(&opts.PruneMethods, "prunemethods", opts.PruneMethods, "drop methods never called nor needed by interfaces which their types are converted to")
+	fs.BoolVar(&opts.PruneFields, "prunefields", opts.PruneFields, "drop struct fields never read nor written unless their types are printed, reflected on, compared or the like")
+	fs.Func("cgo", "set CGO_ENABLED of the target to `0|1` (default: the environment or the default of the target)", func(s string) error {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		opts.CgoEnabled = &b
+		return nil
+	})
+	return fs
+}
+
+// splitList splits the comma-separated list
+func splitList(s string) []string {
+	var res []string
+	for _, elem := range strings.Split(s, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			res = append(res, elem)
+		}
+	}
+	return res
+}
+
+// configDir returns the directory where the config file is searched from
+// for the args: the directory of the first package, or the current one.
+func configDir(args []string) string {
+	if len(args) == 0 || args[0] == "-" {
+		return "."
+	}
+	arg := args[0]
+	if strings.HasSuffix(arg, ".go") {
+		return filepath.Dir(arg)
+	}
+	if i := strings.Index(arg, "..."); 0 <= i {
+		// the longest directory without wildcards
+		return filepath.Dir(arg[:i] + "x")
+	}
+	return arg
+}
+
+// printConfig prints the effective configuration to w in the TOML format
+func printConfig(w io.Writer, cfg *gottani.Config) error {
+	if cfg.Path != "" {
+		fmt.Fprintf(w, "# %s\n", cfg.Path)
+	} else {
+		fmt.Fprintf(w, "# no config file\n")
+	}
+	return toml.NewEncoder(w).Encode(cfg)
+}
+
+// watchMain combines the package given as the args whenever its sources are
+// changed, and writes it to the output until interrupted.  Each result is
+// reported to the log.
+func watchMain(c *gottani.Combiner, args []string, entry, output string, log io.Writer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dir := "."
+	if 0 < len(args) {
+		dir = args[0]
+	}
+	report := func(src []byte, err error) {
+		now := time.Now().Format(time.TimeOnly)
+		if err == nil {
+			err = writeFile(outputPath(output, dir), src)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s\n", now, errorMessage(err))
+			return
+		}
+		fmt.Fprintf(log, "%s wrote %s (%d bytes)\n", now, outputPath(output, dir), len(src))
+	}
+
+	var err error
+	if 0 < len(args) && strings.HasSuffix(args[0], ".go") {
+		dir = filepath.Dir(args[0])
+		err = c.WatchFiles(ctx, args, entry, watchInterval, report)
+	} else {
+		err = c.Watch(ctx, dir, entry, watchInterval, report)
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// cacheMain handles `gottani cache [-dir dir] clean|stats`
+func cacheMain(args []string) error {
+	fs := flag.NewFlagSet("gottani cache", flag.ContinueOnError)
+	dir := fs.String("dir", os.Getenv("GOTTANICACHE"), "the cache `dir` (default: $GOTTANICACHE)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gottani cache [-dir dir] clean|stats\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("cache: one command is required")
+	}
+	if *dir == "" {
+		return errors.New("cache: no cache directory; give -dir or set GOTTANICACHE")
+	}
+
+	switch fs.Arg(0) {
+	case "clean":
+		return gottani.CleanCache(*dir)
+	case "stats":
+		st, err := gottani.GetCacheStats(*dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("directory: %s\n", *dir)
+		fmt.Printf("packages:  %d\n", st.Packages)
+		fmt.Printf("imports:   %d\n", st.Dirs)
+		fmt.Printf("size:      %d bytes\n", st.Size)
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("cache: unknown command %q", fs.Arg(0))
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ktateish/gottani"
+)
+
+func TestExitCode(t *testing.T) {
+	serr := scanner.Error{Pos: token.Position{Filename: "main.go", Line: 3, Column: 5}, Msg: "undefined: x"}
+	prefix := os.Args[0] + ": Error: "
+	testCases := []struct {
+		name string
+		err  error
+		code int
+		msg  string
+	}{
+		{"other", errors.New("writing out.go: permission denied"), exitError, prefix + "writing out.go: permission denied"},
+		{"source", fmt.Errorf("%w: type checking: %w", gottani.ErrLoad, serr), exitSourceError, "main.go:3:5: undefined: x"},
+		{"load", fmt.Errorf("%w: package example.com/x not found", gottani.ErrLoad), exitLoadError, prefix + "loading package information: package example.com/x not found"},
+		{"internal", fmt.Errorf("%w: panic: boom", gottani.ErrCombine), exitInternal, prefix + "combining: panic: boom"},
+		{"profile", fmt.Errorf("%w atcoder: package \"x\" is forbidden", gottani.ErrProfile), exitProfile, prefix + "violating the judge profile atcoder: package \"x\" is forbidden"},
+		{"usage", usageError{errors.New("-v and -q are exclusive")}, exitUsage, prefix + "-v and -q are exclusive"},
+		{"options", fmt.Errorf("%w: CacheDir can't be used with PruneMethods nor PruneFields", gottani.ErrOptions), exitUsage, prefix + "invalid options: CacheDir can't be used with PruneMethods nor PruneFields"},
+		{"entry point", fmt.Errorf("%w: func solve in the package", gottani.ErrEntryPoint), exitEntryPoint, prefix + "entry point not found: func solve in the package"},
+		{"batch", batchError{errs: []error{fmt.Errorf("%w: x", gottani.ErrLoad), fmt.Errorf("%w: y", gottani.ErrCombine)}, total: 3}, exitInternal, prefix + "2 of 3 packages failed"},
+		{"batch source", batchError{errs: []error{fmt.Errorf("%w: %w", gottani.ErrLoad, serr)}, total: 2}, exitSourceError, prefix + "1 of 2 packages failed"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.err); got != tc.code {
+				t.Errorf("exitCode() = %d, want %d", got, tc.code)
+			}
+			if got := errorMessage(tc.err); got != tc.msg {
+				t.Errorf("errorMessage() = %q, want %q", got, tc.msg)
+			}
+		})
+	}
+}
+
+func TestMainErrors(t *testing.T) {
+	t.Setenv("GOTTANICACHE", "")
+	dir := t.TempDir()
+	if err := writeFiles(dir, map[string]string{
+		"go.mod":            "module contest\n\ngo 1.21\n",
+		"ok/main.go":        "package main\n\nfunc main() { println(1) }\n",
+		"solve/main.go":     "package main\n\nfunc solve() { println(1) }\n",
+		"broken/main.go":    "package main\n\nfunc main() { println(x) }\n",
+		"missing/main.go":   "package main\n\nimport \"contest/none\"\n\nfunc main() { none.F() }\n",
+		"pull/main.go":      "package main\n\nimport \"iter\"\n\nfunc main() { _, stop := iter.Pull(func(func(int) bool) {}); stop() }\n",
+		"broken/submit.txt": "the previous output\n",
+	}); err != nil {
+		t.Fatalf("Failed to write files: %s", err)
+	}
+	chdir(t, dir)
+
+	testCases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"flag", []string{"-nosuchflag", "ok"}, exitUsage},
+		{"verbose and quiet", []string{"-v", "-q", "ok"}, exitUsage},
+		{"watch without output", []string{"-watch", "ok"}, exitUsage},
+		{"patterns without output", []string{"./..."}, exitUsage},
+		{"source", []string{"-o", "broken/submit.txt", "broken"}, exitSourceError},
+		{"load", []string{"-o", "missing/submit.go", "missing"}, exitLoadError},
+		{"entry point", []string{"-o", "solve/submit.go", "solve"}, exitEntryPoint},
+		{"not inlinable", []string{"-inline", "iter", "-o", "pull/submit.go", "pull"}, exitLoadError},
+		{"options", []string{"-cache", t.TempDir(), "-prunemethods", "ok"}, exitUsage},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Main(tc.args)
+			if err == nil {
+				t.Fatalf("Main(%q) succeeded unexpectedly", tc.args)
+			}
+			if got := exitCode(err); got != tc.code {
+				t.Errorf("Main(%q) returned %q of the exit code %d, want %d", tc.args, err, got, tc.code)
+			}
+		})
+	}
+
+	// the failures leave the existing output untouched and no temporary files
+	b, err := os.ReadFile(filepath.Join("broken", "submit.txt"))
+	if err != nil || string(b) != "the previous output\n" {
+		t.Errorf("Output is changed by the failure: %q, %v", b, err)
+	}
+	for _, name := range []string{"broken", "missing", "solve", "pull"} {
+		ents, err := os.ReadDir(name)
+		if err != nil {
+			t.Fatalf("Failed to read directory: %s", err)
+		}
+		for _, ent := range ents {
+			if file := ent.Name(); file != "main.go" && file != "submit.txt" {
+				t.Errorf("File %s is left in %s", file, name)
+			}
+		}
+	}
+}
+
+func TestMainOutput(t *testing.T) {
+	t.Setenv("GOTTANICACHE", "")
+	dir := t.TempDir()
+	if err := writeFiles(dir, map[string]string{
+		"go.mod":        "module contest\n\ngo 1.21\n",
+		"a/main.go":     "package main\n\nfunc main() { println(1) }\n",
+		"b/main.go":     "package main\n\nfunc main() { println(2) }\n",
+		"c/main.go":     "package main\n\nfunc main() { println(x) }\n",
+		"out/README.md": "outputs\n",
+	}); err != nil {
+		t.Fatalf("Failed to write files: %s", err)
+	}
+	chdir(t, dir)
+
+	testCases := []struct {
+		name string
+		args []string
+		log  []string // substrings of stderr
+	}{
+		{"default", []string{"-o", "a/submit.go", "a"}, nil},
+		{"verbose", []string{"-v", "-o", "{{dir}}/submit.go", "b"}, []string{"loaded ", "squashed in ", "formatted "}},
+		{"quiet", []string{"-q", "-o", "out/{{name}}.go", "./..."}, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stderr := captureStderr(t, func() {
+				err := Main(tc.args)
+				if tc.name == "quiet" {
+					// c fails but the others are written
+					if got := exitCode(err); got != exitSourceError {
+						t.Errorf("Main(%q) returned %v, want a source error", tc.args, err)
+					}
+				} else if err != nil {
+					t.Errorf("Main(%q) failed: %s", tc.args, err)
+				}
+			})
+			for _, s := range tc.log {
+				if !strings.Contains(stderr, s) {
+					t.Errorf("Stderr lacks %q:\n%s", s, stderr)
+				}
+			}
+			if tc.name == "quiet" && strings.Contains(stderr, "PACKAGE") {
+				t.Errorf("Summary is printed with -q:\n%s", stderr)
+			}
+		})
+	}
+
+	for _, path := range []string{"a/submit.go", "b/submit.go", "out/a.go", "out/b.go"} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read the output: %s", err)
+		}
+		if !strings.HasPrefix(string(b), "// Code generated by Gottani") {
+			t.Errorf("Output %s is not combined source:\n%s", path, b)
+		}
+	}
+	if _, err := os.Stat("out/c.go"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Output of the failed package exists: %v", err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "submit.go")
+	for _, data := range []string{"first\n", "second\n"} {
+		if err := writeFile(path, []byte(data)); err != nil {
+			t.Fatalf("Failed to writeFile(): %s", err)
+		}
+		if b, err := os.ReadFile(path); err != nil || string(b) != data {
+			t.Errorf("File has %q, %v, want %q", b, err, data)
+		}
+	}
+	if err := writeFile(filepath.Join(dir, "none", "submit.go"), []byte("x")); err == nil {
+		t.Errorf("writeFile() succeeded for a missing directory")
+	}
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %s", err)
+	}
+	if len(ents) != 1 {
+		t.Errorf("Temporary files are left: %v", ents)
+	}
+}
+
+// captureStderr returns what fn writes to os.Stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatalf("Failed to create a file: %s", err)
+	}
+	defer f.Close()
+	stderr := os.Stderr
+	os.Stderr = f
+	defer func() { os.Stderr = stderr }()
+	fn()
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("Failed to read a file: %s", err)
+	}
+	return string(b)
+}
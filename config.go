@@ -0,0 +1,150 @@
+package gottani
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ConfigFiles are the names of config files in the order of precedence.
+var ConfigFiles = []string{".gottani.toml", ".gottani.json"}
+
+// Config is a project configuration read from a config file such as
+//
+//	entry = "main"
+//	output = "{{dir}}/submit.go"
+//	goos = "linux"
+//	goarch = "amd64"
+//	tags = ["judge"]
+//	judge = "mine"
+//
+//	[profiles.mine]
+//	go = "go1.20"
+//	allowed = ["example.com/mylib/..."]
+//	max_size = 65536
+//
+// Options holds the settings for combining, and the others are for the
+// command.  Relative paths of goroot and cache are relative to the directory
+// of the file.
+type Config struct {
+	Options
+
+	// Entry is the name of the entry point function.  "main" is used if it
+	// is empty.
+	Entry string `toml:"entry" json:"entry"`
+
+	// Output is the path of the output file like `gottani -o`.
+	Output string `toml:"output" json:"output"`
+
+	// Judge is the name of the profile in Profiles of the Config or the
+	// bundled ones.  Call ResolveProfile to set it to Options.Profile.
+	Judge string `toml:"judge" json:"judge"`
+
+	// Profiles are user-defined profiles.  They take precedence over the
+	// bundled ones of the same names.
+	Profiles map[string]*Profile `toml:"profiles" json:"profiles"`
+
+	// Path is the file which the Config is read from.  It is empty if no
+	// file is found.
+	Path string `toml:"-" json:"-"`
+}
+
+// FindConfig finds a config file in the dir or its parents.  It returns ""
+// if no file is found.
+func FindConfig(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("getting absolute path %q: %w", dir, err)
+	}
+	for d := abs; ; d = filepath.Dir(d) {
+		for _, name := range ConfigFiles {
+			path := filepath.Join(d, name)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+		if d == filepath.Dir(d) {
+			return "", nil
+		}
+	}
+}
+
+// LoadConfig reads the config file in the TOML or JSON format according to
+// its extension.  Unknown keys are errors.
+func LoadConfig(path string) (*Config, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func loadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{Path: path}
+	switch filepath.Ext(path) {
+	case ".toml":
+		md, err := toml.Decode(string(b), cfg)
+		if err != nil {
+			return nil, err
+		}
+		if keys := md.Undecoded(); 0 < len(keys) {
+			var names []string
+			for _, key := range keys {
+				names = append(names, key.String())
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown keys: %s", strings.Join(names, ", "))
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unknown format; it must be .toml or .json")
+	}
+
+	dir := filepath.Dir(path)
+	for _, p := range []*string{&cfg.GOROOT, &cfg.CacheDir} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return cfg, nil
+}
+
+// ResolveProfile sets Options.Profile to the profile named Judge.  It is
+// nil if Judge is empty.
+func (cfg *Config) ResolveProfile() error {
+	cfg.Profile = nil
+	if cfg.Judge == "" {
+		return nil
+	}
+	p, ok := cfg.Profiles[cfg.Judge]
+	if !ok {
+		p, ok = Profiles[cfg.Judge]
+	}
+	if !ok {
+		return fmt.Errorf("unknown judge profile %q", cfg.Judge)
+	}
+	cp := *p
+	cp.Name = cfg.Judge
+	cfg.Profile = &cp
+	return nil
+}
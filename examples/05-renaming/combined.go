@@ -12,9 +12,7 @@ import (
 const lib_Pi = math.Pi
 
 const (
-	lib_ConstA = 1 << iota
-	lib_ConstB
-	lib_ConstC
+	lib_ConstB = 1 << (iota + 1)
 )
 
 var lib_VarX = "This is lib.VarX"
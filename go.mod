@@ -2,4 +2,10 @@ module github.com/ktateish/gottani
 
 go 1.23.0
 
-require golang.org/x/tools v0.33.0
+require (
+	github.com/BurntSushi/toml v1.5.0
+	golang.org/x/mod v0.24.0
+	golang.org/x/tools v0.33.0
+)
+
+require golang.org/x/sync v0.14.0 // indirect
@@ -14,25 +14,48 @@ type PackageInfo interface {
 	Packages() []*build.Package
 	AllPackages() []*build.Package
 	GetAstFiles(bp *build.Package) []*ast.File
-	GetBuildPackage(path, dir string) *build.Package
+	GetBuildPackage(path, dir string) (*build.Package, error)
+	IsExternal(bp *build.Package) bool
+}
+
+// Config is a set of options for ApplicationInfo.
+type Config struct {
+	// PruneMethods makes IsUsed() report only the methods which are called,
+	// taken as method values, or in the method sets of interfaces which
+	// their types are converted to, instead of all the methods of used
+	// types.  See rta for the methods kept for the empty interface.
+	PruneMethods bool
+
+	// PruneFields makes IsUsed() report only the fields of struct types
+	// which are referred or needed by the uses of the types as a whole,
+	// e.g. conversions to interfaces, instead of all the fields of used
+	// types.  See also IsUsedField().
+	PruneFields bool
 }
 
 type ApplicationInfo struct {
 	PackageInfo
 	entrypointName string
+	cfg            Config
 
 	// cache
 	defs  map[*ast.Ident]ast.Node
 	refs  map[ast.Node][]*ast.Ident
 	used  map[ast.Node]bool
-	pkgs  map[ast.Node]*build.Package
-	decls map[*ast.Ident]ast.Node // XDecl or XSpec defining the key
+	idx   *index
+	roots []ast.Node
 }
 
 func NewApplicationInfo(pi PackageInfo, entrypointName string) *ApplicationInfo {
+	return NewApplicationInfoWithConfig(pi, entrypointName, Config{})
+}
+
+// NewApplicationInfoWithConfig creates ApplicationInfo with the given cfg
+func NewApplicationInfoWithConfig(pi PackageInfo, entrypointName string, cfg Config) *ApplicationInfo {
 	return &ApplicationInfo{
 		PackageInfo:    pi,
 		entrypointName: entrypointName,
+		cfg:            cfg,
 	}
 }
 
@@ -78,7 +101,19 @@ func (ai *ApplicationInfo) IsUsed(nd ast.Node) bool {
 
 	used := make(map[ast.Node]bool)
 
+	var r *rta
+	var fu *fieldUsage
 	var rec func(nd ast.Node)
+	dead := make(map[ast.Node]bool) // branches never executed
+	inspect := func(nd ast.Node) {
+		ast.Inspect(nd, func(nd ast.Node) bool {
+			if dead[nd] {
+				return false
+			}
+			rec(nd)
+			return true
+		})
+	}
 	rec = func(nd ast.Node) {
 		if nd == nil {
 			return
@@ -88,11 +123,17 @@ func (ai *ApplicationInfo) IsUsed(nd ast.Node) bool {
 			return
 		}
 		used[nd] = true
+		if r != nil {
+			r.visit(nd)
+		}
+		if fu != nil {
+			fu.visit(nd)
+		}
 
 		switch nd := nd.(type) {
 		case *ast.Ident:
 			id := nd
-			if bp := ai.GetPackage(nd); bp != nil && bp.Goroot {
+			if bp := ai.GetPackage(nd); bp != nil && ai.IsExternal(bp) {
 				return
 			}
 			decl := ai.getDecl(id)
@@ -104,19 +145,44 @@ func (ai *ApplicationInfo) IsUsed(nd ast.Node) bool {
 				rec(def)
 			}
 		case *ast.TypeSpec:
-			ids := ai.GetMethods(nd.Name)
-			for _, id := range ids {
-				rec(id)
+			if r == nil {
+				for _, id := range ai.GetMethods(nd.Name) {
+					rec(id)
+				}
 			}
-			ast.Inspect(nd, func(nd ast.Node) bool {
-				rec(nd)
-				return true
-			})
+			if st, ok := nd.Type.(*ast.StructType); ok && fu != nil {
+				// named fields are marked when they are needed, see fieldUsage
+				used[st], used[st.Fields] = true, true
+				rec(nd.Name)
+				if nd.TypeParams != nil {
+					rec(nd.TypeParams)
+				}
+				for _, field := range st.Fields.List {
+					if len(field.Names) == 0 {
+						rec(field)
+					}
+				}
+				break
+			}
+			inspect(nd)
+		case *ast.ValueSpec:
+			// a const spec without values repeats the type and values of
+			// the previous one
+			if src := ai.index().consts[nd]; src != nil {
+				rec(src.Type)
+				for _, v := range src.Values {
+					rec(v)
+				}
+			}
+			inspect(nd)
+		case *ast.IfStmt, *ast.SwitchStmt:
+			// the branches never executed are not reachable
+			for _, part := range deadParts(ai.TypesInfo(), nd.(ast.Stmt)) {
+				dead[part] = true
+			}
+			inspect(nd)
 		default:
-			ast.Inspect(nd, func(nd ast.Node) bool {
-				rec(nd)
-				return true
-			})
+			inspect(nd)
 		}
 	}
 
@@ -124,33 +190,20 @@ func (ai *ApplicationInfo) IsUsed(nd ast.Node) bool {
 	if ep == nil {
 		return false
 	}
+	if ai.cfg.PruneMethods {
+		r = newRTA(ai, rec)
+	}
+	if ai.cfg.PruneFields {
+		fu = newFieldUsage(ai, rec)
+	}
 	rec(ep)
+	for _, nd := range ai.GetSideEffectRoots() {
+		rec(nd)
+	}
 
 	// check initializers
-	isVar := make(map[*ast.Ident]bool)
-	var initDecls []*ast.FuncDecl
-	for _, p := range ai.Packages() {
-		for _, f := range ai.GetAstFiles(p) {
-			for _, decl := range f.Decls {
-				switch decl := decl.(type) {
-				case *ast.FuncDecl:
-					if decl.Recv == nil && decl.Name.Name == "init" {
-						initDecls = append(initDecls, decl)
-					}
-				case *ast.GenDecl:
-					if decl.Tok != token.VAR {
-						break
-					}
-					for _, spec := range decl.Specs {
-						spec := spec.(*ast.ValueSpec)
-						for _, name := range spec.Names {
-							isVar[name] = true
-						}
-					}
-				}
-			}
-		}
-	}
+	isVar := ai.index().vars
+	initDecls := ai.index().inits
 
 	memo := make(map[ast.Node]bool)
 	var rec2 func(node ast.Node) bool
@@ -168,7 +221,7 @@ func (ai *ApplicationInfo) IsUsed(nd ast.Node) bool {
 		case *ast.Ident:
 			id := node
 			bp := ai.GetPackage(id)
-			if bp != nil && bp.Goroot {
+			if bp != nil && ai.IsExternal(bp) {
 				break
 			}
 			if isVar[id] && used[id] {
@@ -219,29 +272,23 @@ func (ai *ApplicationInfo) IsUsed(nd ast.Node) bool {
 	return used[nd]
 }
 
+// IsUsedField reports whether the field of a struct type is used.  It is
+// always true unless Config.PruneFields is given.
+func (ai *ApplicationInfo) IsUsedField(v *types.Var) bool {
+	if !ai.cfg.PruneFields {
+		return true
+	}
+	id := ai.index().fields[v.Origin()]
+	return id == nil || ai.IsUsed(id)
+}
+
 func (ai *ApplicationInfo) IsMethod(nd ast.Node) bool {
 	id, ok := nd.(*ast.Ident)
 	if !ok {
 		return false
 	}
-	var res bool
-	for _, p := range ai.Packages() {
-		for _, f := range ai.GetAstFiles(p) {
-			ast.Inspect(f, func(node ast.Node) bool {
-				switch decl := node.(type) {
-				case *ast.GenDecl:
-					return false
-				case *ast.FuncDecl:
-					if decl.Name == id {
-						res = decl.Recv != nil
-					}
-					return false
-				}
-				return true
-			})
-		}
-	}
-	return res
+	decl, ok := ai.index().funcs[id]
+	return ok && decl.Recv != nil
 }
 
 func (ai *ApplicationInfo) IsInit(nd ast.Node) bool {
@@ -249,163 +296,37 @@ func (ai *ApplicationInfo) IsInit(nd ast.Node) bool {
 	if !ok {
 		return false
 	}
-	if id.Name != "init" {
-		return false
-	}
-	var res bool
-	for _, p := range ai.Packages() {
-		for _, f := range ai.GetAstFiles(p) {
-			ast.Inspect(f, func(node ast.Node) bool {
-				switch decl := node.(type) {
-				case *ast.GenDecl:
-					return false
-				case *ast.FuncDecl:
-					if decl.Name == id {
-						res = decl.Name.Name == "init" && decl.Recv == nil
-					}
-					return false
-				}
-				return true
-			})
-		}
-	}
-	return res
+	decl, ok := ai.index().funcs[id]
+	return ok && decl.Name.Name == "init" && decl.Recv == nil
 }
 
 func (ai *ApplicationInfo) GetEntryPointDecl() *ast.FuncDecl {
-	var res *ast.FuncDecl
-	for _, f := range ai.GetAstFiles(ai.Root()) {
-		ast.Inspect(f, func(node ast.Node) bool {
-			switch decl := node.(type) {
-			case *ast.GenDecl:
-				return false
-			case *ast.FuncDecl:
-				if decl.Name.Name == ai.entrypointName && decl.Recv == nil {
-					res = decl
-				}
-				return false
-			}
-			return true
-		})
-	}
-	return res
+	return ai.index().entryPoint
 }
 
 // Returns methods of the given id if the id is the Name (*ast.Ident) of the *ast.FuncDecl
 func (ai *ApplicationInfo) GetMethods(id *ast.Ident) []*ast.Ident {
-	obj, ok := ai.TypesInfo().Defs[id]
-	if !ok {
-		return nil
-	}
+	obj := ai.TypesInfo().Defs[id]
 	if obj == nil {
 		return nil
 	}
-
-	for _, p := range ai.Packages() {
-		var res []*ast.Ident
-		for _, f := range ai.GetAstFiles(p) {
-			ast.Inspect(f, func(node ast.Node) bool {
-				switch decl := node.(type) {
-				case *ast.GenDecl:
-					return false
-				case *ast.FuncDecl:
-					if decl.Recv == nil {
-						return false
-					}
-					var isObjsMethod bool
-					ast.Inspect(decl.Recv.List[0].Type, func(node ast.Node) bool {
-						tid, ok := node.(*ast.Ident)
-						if !ok {
-							return true
-						}
-						robj, ok := ai.TypesInfo().Uses[tid]
-						if !ok {
-							return false
-						}
-						if robj == nil {
-							return false
-						}
-						isObjsMethod = obj == robj
-						return false
-					})
-					if !isObjsMethod {
-						return false
-					}
-					res = append(res, decl.Name)
-					return false
-				}
-				return true
-			})
-		}
-		if 0 < len(res) {
-			return res
-		}
-	}
-
-	return nil
+	return ai.index().methods[obj]
 }
 
 func (ai *ApplicationInfo) GetFuncDecl(id *ast.Ident) *ast.FuncDecl {
-	for _, p := range ai.Packages() {
-		for _, f := range ai.GetAstFiles(p) {
-			var res *ast.FuncDecl
-			ast.Inspect(f, func(node ast.Node) bool {
-				decl, ok := node.(*ast.FuncDecl)
-				if !ok {
-					if _, ok := node.(*ast.GenDecl); ok {
-						return false
-					}
-					return true
-				}
-				fid := decl.Name
-				if id == fid {
-					res = decl
-					return false
-				}
-				return false
-			})
-			if res != nil {
-				return res
-			}
-		}
-	}
-	return nil
+	return ai.index().funcs[id]
 }
 
 func (ai *ApplicationInfo) GetFile(nd ast.Node) *ast.File {
-	for _, p := range ai.Packages() {
-		for _, f := range ai.GetAstFiles(p) {
-			var res *ast.File
-			ast.Inspect(f, func(node ast.Node) bool {
-				if nd == node {
-					res = f
-					return false
-				}
-				return true
-			})
-			if res != nil {
-				return res
-			}
-		}
+	ni := ai.index().nodes[nd]
+	if ni.pkg == nil || ai.IsExternal(ni.pkg) {
+		return nil
 	}
-	return nil
+	return ni.file
 }
 
 func (ai *ApplicationInfo) GetPackage(nd ast.Node) *build.Package {
-	if ai.pkgs != nil {
-		return ai.pkgs[nd]
-	}
-	pkgs := make(map[ast.Node]*build.Package)
-	for _, p := range ai.AllPackages() {
-		for _, f := range ai.GetAstFiles(p) {
-			ast.Inspect(f, func(node ast.Node) bool {
-				pkgs[node] = p
-				return true
-			})
-		}
-	}
-	ai.pkgs = pkgs
-	return pkgs[nd]
+	return ai.index().nodes[nd].pkg
 }
 
 func (ai *ApplicationInfo) Squash() (*SquashedApp, error) {
@@ -414,46 +335,7 @@ func (ai *ApplicationInfo) Squash() (*SquashedApp, error) {
 
 // getDecl returns thedeclaration node (XxxSpec, FuncDecl, ...) for the given identity or nil
 func (ai *ApplicationInfo) getDecl(id *ast.Ident) ast.Node {
-	if ai.decls != nil {
-		return ai.decls[id]
-	}
-
-	decls := make(map[*ast.Ident]ast.Node)
-	for _, p := range ai.Packages() {
-		for _, f := range ai.GetAstFiles(p) {
-			for _, decl := range f.Decls {
-				switch decl := decl.(type) {
-				case *ast.GenDecl:
-					switch decl.Tok {
-					case token.IMPORT:
-						for _, spec := range decl.Specs {
-							spec := spec.(*ast.ImportSpec)
-							if spec.Name != nil {
-								decls[spec.Name] = spec
-							}
-						}
-					case token.CONST, token.VAR:
-						for _, spec := range decl.Specs {
-							spec := spec.(*ast.ValueSpec)
-							for _, name := range spec.Names {
-								decls[name] = spec
-							}
-						}
-					case token.TYPE:
-						for _, spec := range decl.Specs {
-							spec := spec.(*ast.TypeSpec)
-							decls[spec.Name] = spec
-						}
-					}
-				case *ast.FuncDecl:
-					decls[decl.Name] = decl
-				}
-			}
-		}
-	}
-
-	ai.decls = decls
-	return decls[id]
+	return ai.index().decls[id]
 }
 
 // It creates and returns 2 maps. The first one is defs; map from *ast.Ident/*ast.SelectorExpr to *ast.ImportSpec/*ast.Ident.
@@ -471,6 +353,10 @@ func createDefsAndReferrings(tinfo *types.Info) (map[*ast.Ident]ast.Node, map[as
 	refs := make(map[ast.Node][]*ast.Ident)
 	for id, obj := range tinfo.Uses {
 		def, ok := obj2def[obj]
+		if !ok {
+			// methods and fields of instantiated generic types
+			def, ok = obj2def[origin(obj)]
+		}
 		if !ok || def == nil {
 			continue
 		}
@@ -482,6 +368,9 @@ func createDefsAndReferrings(tinfo *types.Info) (map[*ast.Ident]ast.Node, map[as
 			continue
 		}
 		def, ok := obj2def[sel.Obj()]
+		if !ok {
+			def, ok = obj2def[origin(sel.Obj())]
+		}
 		if !ok || def == nil {
 			continue
 		}
@@ -490,3 +379,14 @@ func createDefsAndReferrings(tinfo *types.Info) (map[*ast.Ident]ast.Node, map[as
 	}
 	return defs, refs
 }
+
+// origin returns the generic object which obj is instantiated from or obj
+func origin(obj types.Object) types.Object {
+	switch obj := obj.(type) {
+	case *types.Func:
+		return obj.Origin()
+	case *types.Var:
+		return obj.Origin()
+	}
+	return obj
+}
@@ -0,0 +1,291 @@
+package appinfo
+
+import (
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+)
+
+// conversions finds the conversions of values, both implicit and explicit, in
+// nodes and reports their types to fn.  A type argument is reported as
+// conversions to its type parameter and any because its values may be used
+// through the constraint and converted to interfaces in the generic code.
+// An assertion of an interface value to another interface is reported as
+// a conversion between them.
+type conversions struct {
+	tinfo   *types.Info
+	results map[*ast.ReturnStmt]*types.Signature // return statement => signature of the enclosing function
+	fn      func(from, to types.Type)
+}
+
+func newConversions(ai *ApplicationInfo, fn func(from, to types.Type)) *conversions {
+	c := &conversions{
+		tinfo:   ai.TypesInfo(),
+		results: make(map[*ast.ReturnStmt]*types.Signature),
+		fn:      fn,
+	}
+	forEachFile(ai, func(_ *build.Package, f *ast.File) {
+		ast.Inspect(f, func(nd ast.Node) bool {
+			switch nd := nd.(type) {
+			case *ast.FuncDecl:
+				if obj := c.tinfo.Defs[nd.Name]; obj != nil && nd.Body != nil {
+					c.addReturns(nd.Body, obj.Type().(*types.Signature))
+				}
+				return false
+			case *ast.FuncLit:
+				// in the initializers of package-level vars
+				if sig, ok := c.tinfo.TypeOf(nd).(*types.Signature); ok {
+					c.addReturns(nd.Body, sig)
+				}
+				return false
+			}
+			return true
+		})
+	})
+	return c
+}
+
+// addReturns records the sig for the return statements in the body, and
+// the signatures of the function literals for the ones in them
+func (c *conversions) addReturns(body *ast.BlockStmt, sig *types.Signature) {
+	ast.Inspect(body, func(nd ast.Node) bool {
+		switch nd := nd.(type) {
+		case *ast.FuncLit:
+			if sig, ok := c.tinfo.TypeOf(nd).(*types.Signature); ok {
+				c.addReturns(nd.Body, sig)
+			}
+			return false
+		case *ast.ReturnStmt:
+			c.results[nd] = sig
+		}
+		return true
+	})
+}
+
+// visit finds conversions in the node
+func (c *conversions) visit(nd ast.Node) {
+	tinfo := c.tinfo
+	switch nd := nd.(type) {
+	case *ast.Ident:
+		// type arguments may be used through the constraints
+		if inst, ok := tinfo.Instances[nd]; ok {
+			tparams := typeParams(tinfo.Uses[nd])
+			for i := 0; i < inst.TypeArgs.Len(); i++ {
+				if i < tparams.Len() {
+					c.fn(inst.TypeArgs.At(i), tparams.At(i))
+				}
+				c.fn(inst.TypeArgs.At(i), types.Universe.Lookup("any").Type())
+			}
+		}
+	case *ast.CallExpr:
+		tv, ok := tinfo.Types[nd.Fun]
+		if !ok {
+			return
+		}
+		if tv.IsType() {
+			if len(nd.Args) == 1 {
+				c.fn(tinfo.TypeOf(nd.Args[0]), tv.Type)
+			}
+			return
+		}
+		sig, ok := tv.Type.Underlying().(*types.Signature)
+		if !ok {
+			return
+		}
+		params := sig.Params()
+		c.convertTuple(nd.Args, func(i int) types.Type {
+			if sig.Variadic() && params.Len()-1 <= i {
+				last := params.At(params.Len() - 1).Type()
+				if nd.Ellipsis.IsValid() {
+					return last
+				}
+				if s, ok := last.Underlying().(*types.Slice); ok {
+					return s.Elem()
+				}
+				return nil
+			}
+			if i < params.Len() {
+				return params.At(i).Type()
+			}
+			return nil
+		})
+	case *ast.AssignStmt:
+		if nd.Tok != token.ASSIGN && nd.Tok != token.DEFINE {
+			return
+		}
+		c.convertTuple(nd.Rhs, func(i int) types.Type {
+			if i < len(nd.Lhs) {
+				return tinfo.TypeOf(nd.Lhs[i])
+			}
+			return nil
+		})
+	case *ast.RangeStmt:
+		if nd.Tok != token.ASSIGN {
+			return
+		}
+		t := tinfo.TypeOf(nd.X)
+		if t == nil {
+			return
+		}
+		if p, ok := t.Underlying().(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		switch t := t.Underlying().(type) {
+		case *types.Slice:
+			c.fn(t.Elem(), tinfo.TypeOf(nd.Value))
+		case *types.Array:
+			c.fn(t.Elem(), tinfo.TypeOf(nd.Value))
+		case *types.Map:
+			c.fn(t.Key(), tinfo.TypeOf(nd.Key))
+			c.fn(t.Elem(), tinfo.TypeOf(nd.Value))
+		}
+	case *ast.ValueSpec:
+		if nd.Type == nil {
+			return
+		}
+		to := tinfo.TypeOf(nd.Type)
+		c.convertTuple(nd.Values, func(int) types.Type { return to })
+	case *ast.ReturnStmt:
+		sig := c.results[nd]
+		if sig == nil {
+			return
+		}
+		c.convertTuple(nd.Results, func(i int) types.Type {
+			if i < sig.Results().Len() {
+				return sig.Results().At(i).Type()
+			}
+			return nil
+		})
+	case *ast.CompositeLit:
+		c.compositeLit(nd)
+	case *ast.SendStmt:
+		if ch, ok := tinfo.TypeOf(nd.Chan).Underlying().(*types.Chan); ok {
+			c.fn(tinfo.TypeOf(nd.Value), ch.Elem())
+		}
+	case *ast.BinaryExpr:
+		if nd.Op == token.EQL || nd.Op == token.NEQ {
+			x, y := tinfo.TypeOf(nd.X), tinfo.TypeOf(nd.Y)
+			c.fn(x, y)
+			c.fn(y, x)
+		}
+	case *ast.IndexExpr:
+		if t := tinfo.TypeOf(nd.X); t != nil {
+			if m, ok := t.Underlying().(*types.Map); ok {
+				c.fn(tinfo.TypeOf(nd.Index), m.Key())
+			}
+		}
+	case *ast.TypeAssertExpr:
+		if nd.Type != nil {
+			c.assert(tinfo.TypeOf(nd.X), tinfo.TypeOf(nd.Type))
+		}
+	case *ast.TypeSwitchStmt:
+		var x ast.Expr
+		switch stmt := nd.Assign.(type) {
+		case *ast.ExprStmt:
+			x = stmt.X
+		case *ast.AssignStmt:
+			x = stmt.Rhs[0]
+		}
+		assert, ok := ast.Unparen(x).(*ast.TypeAssertExpr)
+		if !ok {
+			return
+		}
+		for _, stmt := range nd.Body.List {
+			for _, expr := range stmt.(*ast.CaseClause).List {
+				c.assert(tinfo.TypeOf(assert.X), tinfo.TypeOf(expr))
+			}
+		}
+	case *ast.SwitchStmt:
+		if nd.Tag == nil {
+			return
+		}
+		tag := tinfo.TypeOf(nd.Tag)
+		for _, stmt := range nd.Body.List {
+			for _, expr := range stmt.(*ast.CaseClause).List {
+				c.fn(tinfo.TypeOf(expr), tag)
+				c.fn(tag, tinfo.TypeOf(expr))
+			}
+		}
+	}
+}
+
+// assert reports the assertion of a value of the type from to the type to
+// if both are interfaces
+func (c *conversions) assert(from, to types.Type) {
+	if from != nil && to != nil && types.IsInterface(from) && types.IsInterface(to) {
+		c.fn(from, to)
+	}
+}
+
+// typeParams returns the type parameters of the generic function or type
+func typeParams(obj types.Object) *types.TypeParamList {
+	if obj == nil {
+		return nil
+	}
+	switch t := obj.Type().(type) {
+	case *types.Signature:
+		return t.TypeParams()
+	case *types.Named:
+		return t.TypeParams()
+	}
+	return nil
+}
+
+// convertTuple converts the values to the types given by the to function
+// for their indices.  A single value may be a tuple of multiple values.
+func (c *conversions) convertTuple(values []ast.Expr, to func(int) types.Type) {
+	tinfo := c.tinfo
+	if len(values) == 1 {
+		if tuple, ok := tinfo.TypeOf(values[0]).(*types.Tuple); ok {
+			for i := 0; i < tuple.Len(); i++ {
+				c.fn(tuple.At(i).Type(), to(i))
+			}
+			return
+		}
+	}
+	for i, v := range values {
+		c.fn(tinfo.TypeOf(v), to(i))
+	}
+}
+
+func (c *conversions) compositeLit(lit *ast.CompositeLit) {
+	tinfo := c.tinfo
+	t := tinfo.TypeOf(lit)
+	if t == nil {
+		return
+	}
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		// elided &T in an element
+		t = p.Elem()
+	}
+	switch t := t.Underlying().(type) {
+	case *types.Struct:
+		for i, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if key, ok := kv.Key.(*ast.Ident); ok {
+					if f, ok := tinfo.Uses[key].(*types.Var); ok {
+						c.fn(tinfo.TypeOf(kv.Value), f.Type())
+					}
+				}
+			} else if i < t.NumFields() {
+				c.fn(tinfo.TypeOf(elt), t.Field(i).Type())
+			}
+		}
+	case *types.Map:
+		for _, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				c.fn(tinfo.TypeOf(kv.Key), t.Key())
+				c.fn(tinfo.TypeOf(kv.Value), t.Elem())
+			}
+		}
+	case *types.Slice, *types.Array:
+		elem := t.(interface{ Elem() types.Type }).Elem()
+		for _, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = kv.Value
+			}
+			c.fn(tinfo.TypeOf(elt), elem)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package appinfo
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+)
+
+// copier deep-copies AST nodes.  It keeps mapping from the original nodes to
+// the copies so that modifications for the original nodes can be applied to
+// the copies instead.  The original nodes are kept intact because they may be
+// shared with other applications.
+type copier struct {
+	copies map[any]any // original pointer => copied pointer
+	pos    token.Pos   // if valid, all the positions in the copies are replaced with it
+}
+
+func newCopier() *copier {
+	return &copier{
+		copies: make(map[any]any),
+	}
+}
+
+// copyDecl returns the deep copy of the given decl.
+func (cp *copier) copyDecl(decl ast.Decl) ast.Decl {
+	return cp.copy(reflect.ValueOf(decl)).Interface().(ast.Decl)
+}
+
+// copyImportSpec returns the deep copy of the given spec.
+func (cp *copier) copyImportSpec(spec *ast.ImportSpec) *ast.ImportSpec {
+	return cp.copy(reflect.ValueOf(spec)).Interface().(*ast.ImportSpec)
+}
+
+// copyExpr returns the deep copy of the given expr.
+func (cp *copier) copyExpr(expr ast.Expr) ast.Expr {
+	if expr == nil {
+		return nil
+	}
+	return cp.copy(reflect.ValueOf(expr)).Interface().(ast.Expr)
+}
+
+// ident returns the copy of the given id or nil if it is not copied.
+func (cp *copier) ident(id *ast.Ident) *ast.Ident {
+	c, _ := cp.copies[id].(*ast.Ident)
+	return c
+}
+
+// commentGroup returns the copy of the given cg or cg itself if it is not copied.
+func (cp *copier) commentGroup(cg *ast.CommentGroup) *ast.CommentGroup {
+	if c, ok := cp.copies[cg].(*ast.CommentGroup); ok {
+		return c
+	}
+	return cg
+}
+
+// rename renames the copy of the given id.
+func (cp *copier) rename(id *ast.Ident, name string) {
+	if c := cp.ident(id); c != nil {
+		c.Name = name
+	}
+}
+
+func (cp *copier) copy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		switch v.Interface().(type) {
+		case *ast.Object, *ast.Scope:
+			// deprecated syntactic resolution is not needed for printing
+			return reflect.Zero(v.Type())
+		}
+		if c, ok := cp.copies[v.Interface()]; ok {
+			return reflect.ValueOf(c)
+		}
+		c := reflect.New(v.Type().Elem())
+		cp.copies[v.Interface()] = c.Interface()
+		c.Elem().Set(cp.copy(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(cp.copy(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			c.Field(i).Set(cp.copy(v.Field(i)))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(cp.copy(v.Index(i)))
+		}
+		return c
+	default:
+		if cp.pos.IsValid() && v.Type() == reflect.TypeOf(token.NoPos) && token.Pos(v.Int()).IsValid() {
+			return reflect.ValueOf(cp.pos)
+		}
+		return v
+	}
+}
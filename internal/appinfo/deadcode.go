@@ -0,0 +1,426 @@
+package appinfo
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// deadParts returns the parts of the if or switch statement which are never
+// executed because of constant conditions, e.g. the body of `if debug {...}`
+// with `const debug = false`:
+//
+//   - the body or the else branch of *ast.IfStmt
+//   - *ast.CaseClause of *ast.SwitchStmt which never match or are never
+//     reached because a former clause always matches
+//
+// It returns nil if the statement has no such parts or they can't be removed
+// safely, e.g. they jump to labels outside of them, or the default clause is
+// dead but the clause always matching can't replace the switch, see
+// splicedClause().
+func deadParts(tinfo *types.Info, stmt ast.Stmt) []ast.Node {
+	var dead []ast.Node
+	switch stmt := stmt.(type) {
+	case *ast.IfStmt:
+		cond, ok := constValue(tinfo, stmt.Cond)
+		if !ok || cond.Kind() != constant.Bool {
+			return nil
+		}
+		if !constant.BoolVal(cond) {
+			dead = append(dead, stmt.Body)
+		} else if stmt.Else != nil {
+			dead = append(dead, stmt.Else)
+		}
+	case *ast.SwitchStmt:
+		tag := constant.MakeBool(true)
+		if stmt.Tag != nil {
+			var ok bool
+			if tag, ok = constValue(tinfo, stmt.Tag); !ok {
+				return nil
+			}
+		}
+		var def *ast.CaseClause
+		var matched bool // a former clause always matches
+		for _, s := range stmt.Body.List {
+			clause := s.(*ast.CaseClause)
+			if hasFallthrough(clause) {
+				return nil
+			}
+			if clause.List == nil {
+				def = clause
+				continue
+			}
+			if matched {
+				dead = append(dead, clause)
+				continue
+			}
+			always, never := matchCase(tinfo, tag, clause.List)
+			if never {
+				dead = append(dead, clause)
+			}
+			matched = always
+		}
+		if matched && def != nil {
+			dead = append(dead, def)
+			if splicedClause(tinfo, stmt, dead) == nil {
+				// the switch may be a terminating statement, which it is
+				// no longer without the default
+				return nil
+			}
+		}
+	}
+	for _, nd := range dead {
+		if jumpsOut(tinfo, nd) {
+			return nil
+		}
+	}
+	return dead
+}
+
+// splicedClause returns the only clause of the switch left by removing the
+// dead ones if its body can replace the switch, or nil otherwise.  The body
+// can't do it if it breaks out of the switch or if the clause has case
+// expressions evaluated at runtime.
+func splicedClause(tinfo *types.Info, stmt *ast.SwitchStmt, dead []ast.Node) *ast.CaseClause {
+	var live *ast.CaseClause
+	for _, s := range stmt.Body.List {
+		if slices.Contains(dead, ast.Node(s)) {
+			continue
+		}
+		if live != nil {
+			return nil
+		}
+		live = s.(*ast.CaseClause)
+	}
+	if live == nil || breaks(live) || jumpsOut(tinfo, live) {
+		return nil
+	}
+	for _, expr := range live.List {
+		if _, ok := constValue(tinfo, expr); !ok {
+			return nil
+		}
+	}
+	return live
+}
+
+// constValue returns the constant value of the expr if it is constant
+func constValue(tinfo *types.Info, expr ast.Expr) (constant.Value, bool) {
+	tv, ok := tinfo.Types[expr]
+	if !ok || tv.Value == nil || tv.Value.Kind() == constant.Unknown {
+		return nil, false
+	}
+	return tv.Value, true
+}
+
+// matchCase reports whether the tag always or never matches any of the
+// exprs of a case clause.  Both are false if it depends on the runtime values.
+func matchCase(tinfo *types.Info, tag constant.Value, exprs []ast.Expr) (always, never bool) {
+	never = true
+	for _, expr := range exprs {
+		v, ok := constValue(tinfo, expr)
+		if !ok || !comparable(tag, v) {
+			never = false
+			continue
+		}
+		if constant.Compare(tag, token.EQL, v) {
+			return true, false
+		}
+	}
+	return false, never
+}
+
+// comparable reports whether the constant values can be compared with
+// constant.Compare()
+func comparable(x, y constant.Value) bool {
+	isNumeric := func(v constant.Value) bool {
+		switch v.Kind() {
+		case constant.Int, constant.Float, constant.Complex:
+			return true
+		}
+		return false
+	}
+	return x.Kind() == y.Kind() || isNumeric(x) && isNumeric(y)
+}
+
+// hasFallthrough reports whether the clause falls through into the next one
+func hasFallthrough(clause *ast.CaseClause) bool {
+	if len(clause.Body) == 0 {
+		return false
+	}
+	br, ok := clause.Body[len(clause.Body)-1].(*ast.BranchStmt)
+	return ok && br.Tok == token.FALLTHROUGH
+}
+
+// jumpsOut reports whether the node has goto, break or continue statements
+// with labels defined outside of it, which would be left unused without it
+func jumpsOut(tinfo *types.Info, nd ast.Node) bool {
+	var found bool
+	ast.Inspect(nd, func(node ast.Node) bool {
+		if br, ok := node.(*ast.BranchStmt); ok && br.Label != nil {
+			if obj := tinfo.Uses[br.Label]; obj == nil || !within(nd, obj.Pos()) {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// breaks reports whether the clause has break statements without labels
+// which terminate its switch
+func breaks(clause *ast.CaseClause) bool {
+	var found bool
+	ast.Inspect(clause, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt, *ast.FuncLit:
+			return false
+		case *ast.BranchStmt:
+			if node.Tok == token.BREAK && node.Label == nil {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func within(nd ast.Node, pos token.Pos) bool {
+	return nd.Pos() <= pos && pos < nd.End()
+}
+
+// pruneDeadBranches removes the parts never executed, see deadParts(), from
+// the if and switch statements in the copy of the decl.  An if statement, or
+// a switch statement left with at most one clause, is replaced with the
+// live branch, so that a terminating statement stays terminating.  Local
+// variables read only in the removed parts are assigned to the blank
+// identifier so that they are still used.  It returns the removed parts.
+func pruneDeadBranches(ai appInfo, cp *copier, decl ast.Decl) []ast.Node {
+	tinfo := ai.TypesInfo()
+
+	origs := make(map[ast.Node]ast.Stmt) // copies => originals
+	var removed []ast.Node
+	ast.Inspect(decl, func(node ast.Node) bool {
+		if slices.Contains(removed, node) {
+			return false
+		}
+		switch node := node.(type) {
+		case *ast.IfStmt, *ast.SwitchStmt:
+			if dead := deadParts(tinfo, node.(ast.Stmt)); dead != nil {
+				origs[cp.copies[node].(ast.Node)] = node.(ast.Stmt)
+				removed = append(removed, dead...)
+			}
+		}
+		return true
+	})
+	if len(origs) == 0 {
+		return nil
+	}
+
+	// local variables still read
+	read := make(map[*types.Var]bool)
+	forEachRead(tinfo, decl, removed, func(v *types.Var) {
+		read[v] = true
+	})
+	params := make(map[*types.Var]bool)
+	ast.Inspect(decl, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			addParams(tinfo, params, node.Recv)
+		case *ast.FuncType:
+			addParams(tinfo, params, node.Params)
+			addParams(tinfo, params, node.Results)
+		}
+		return true
+	})
+	// uses returns a `_, _ = v, w` statement for the local variables
+	// declared outside of the dead parts and read only in them
+	uses := func(dead []ast.Node, pos token.Pos) []ast.Stmt {
+		as := &ast.AssignStmt{TokPos: pos, Tok: token.ASSIGN}
+		for _, nd := range dead {
+			forEachRead(tinfo, nd, nil, func(v *types.Var) {
+				if read[v] || params[v] || v.Parent() == v.Pkg().Scope() || within(nd, v.Pos()) {
+					return
+				}
+				read[v] = true
+				as.Lhs = append(as.Lhs, &ast.Ident{NamePos: pos, Name: "_"})
+				as.Rhs = append(as.Rhs, &ast.Ident{NamePos: pos, Name: v.Name()})
+			})
+		}
+		if len(as.Lhs) == 0 {
+			return nil
+		}
+		return []ast.Stmt{as}
+	}
+
+	emptied := make(map[ast.Stmt]bool) // else branches left empty
+	astutil.Apply(cp.copies[decl].(ast.Node), nil, func(c *astutil.Cursor) bool {
+		if s, ok := c.Node().(*ast.IfStmt); ok && emptied[s.Else] {
+			s.Else = nil
+		}
+		orig, ok := origs[c.Node()]
+		if !ok {
+			return true
+		}
+		dead := deadParts(tinfo, orig)
+		switch s := c.Node().(type) {
+		case *ast.IfStmt:
+			var live ast.Stmt = s.Body
+			if slices.Contains(dead, ast.Node(orig.(*ast.IfStmt).Body)) {
+				live = s.Else
+			}
+			replaceStmt(c, s.Init, uses(dead, orig.Pos()), live, emptied)
+		case *ast.SwitchStmt:
+			sw := orig.(*ast.SwitchStmt)
+			live := splicedClause(tinfo, sw, dead)
+			if live != nil || len(dead) == len(sw.Body.List) {
+				// the body of the only clause left replaces the switch as
+				// the branch of an if statement does
+				var body ast.Stmt
+				if live != nil {
+					i := slices.Index(sw.Body.List, ast.Stmt(live))
+					cc := s.Body.List[i].(*ast.CaseClause)
+					body = &ast.BlockStmt{Lbrace: cc.Colon, List: cc.Body, Rbrace: cc.End()}
+				}
+				replaceStmt(c, s.Init, uses(dead, orig.Pos()), body, emptied)
+				break
+			}
+			// the clauses left are kept ending with the same statements,
+			// so the variables are used at the beginning of the first one
+			var clauses []ast.Stmt
+			for i, clause := range sw.Body.List {
+				if !slices.Contains(dead, ast.Node(clause)) {
+					clauses = append(clauses, s.Body.List[i])
+				}
+			}
+			cc := clauses[0].(*ast.CaseClause)
+			cc.Body = append(uses(dead, cc.Colon), cc.Body...)
+			s.Body.List = clauses
+		}
+		return true
+	})
+	return removed
+}
+
+func addParams(tinfo *types.Info, params map[*types.Var]bool, fl *ast.FieldList) {
+	if fl == nil {
+		return
+	}
+	for _, field := range fl.List {
+		for _, name := range field.Names {
+			if v, ok := tinfo.Defs[name].(*types.Var); ok {
+				params[v] = true
+			}
+		}
+	}
+}
+
+// forEachRead calls fn for each variable read in the node except the skipped
+// parts.  Variables only assigned, e.g. x in `x = 1`, are not read.
+func forEachRead(tinfo *types.Info, nd ast.Node, skipped []ast.Node, fn func(*types.Var)) {
+	var exprs func(exprs ...ast.Expr)
+	var visit func(node ast.Node) bool
+	exprs = func(exprs ...ast.Expr) {
+		for _, expr := range exprs {
+			if expr != nil {
+				ast.Inspect(expr, visit)
+			}
+		}
+	}
+	// assigned visits the exprs to be assigned except variables themselves
+	assigned := func(lhs ...ast.Expr) {
+		for _, expr := range lhs {
+			if _, ok := ast.Unparen(expr).(*ast.Ident); !ok {
+				exprs(expr)
+			}
+		}
+	}
+	visit = func(node ast.Node) bool {
+		if node == nil || slices.Contains(skipped, node) {
+			return false
+		}
+		switch node := node.(type) {
+		case *ast.AssignStmt:
+			if node.Tok == token.ASSIGN || node.Tok == token.DEFINE {
+				assigned(node.Lhs...)
+				exprs(node.Rhs...)
+				return false
+			}
+		case *ast.RangeStmt:
+			if node.Tok == token.ASSIGN {
+				assigned(node.Key, node.Value)
+				exprs(node.X)
+				ast.Inspect(node.Body, visit)
+				return false
+			}
+		case *ast.Ident:
+			if v, ok := tinfo.Uses[node].(*types.Var); ok && !v.IsField() {
+				fn(v)
+			}
+		}
+		return true
+	}
+	ast.Inspect(nd, visit)
+}
+
+// replaceStmt replaces the current if or switch statement of the cursor with
+// its init, the uses and the live branch.  The statements in the live block
+// are spliced if it declares nothing, otherwise the block is kept for the
+// scope.
+// They are wrapped in a block if the init declares variables or the
+// statement is not in a list, e.g. an else branch.  An else branch left
+// empty is recorded in emptied to be removed by the parent.
+func replaceStmt(c *astutil.Cursor, init ast.Stmt, uses []ast.Stmt, live ast.Stmt, emptied map[ast.Stmt]bool) {
+	var list []ast.Stmt
+	if init != nil {
+		list = append(list, init)
+	}
+	list = append(list, uses...)
+	if b, ok := live.(*ast.BlockStmt); ok && !declares(b.List) {
+		list = append(list, b.List...)
+	} else if live != nil {
+		list = append(list, live)
+	}
+
+	switch {
+	case init == nil && c.Index() >= 0:
+		for _, s := range list {
+			c.InsertBefore(s)
+		}
+		c.Delete()
+	case init == nil && len(list) == 1 && isBlockOrIf(list[0]):
+		c.Replace(list[0])
+	default:
+		b := &ast.BlockStmt{Lbrace: c.Node().Pos(), List: list, Rbrace: c.Node().End() - 1}
+		if _, ok := c.Parent().(*ast.IfStmt); ok && len(list) == 0 {
+			emptied[b] = true
+		}
+		c.Replace(b)
+	}
+}
+
+func isBlockOrIf(s ast.Stmt) bool {
+	switch s.(type) {
+	case *ast.BlockStmt, *ast.IfStmt:
+		return true
+	}
+	return false
+}
+
+// declares reports whether the statements declare any names in their block
+func declares(list []ast.Stmt) bool {
+	for _, s := range list {
+		switch s := s.(type) {
+		case *ast.DeclStmt:
+			return true
+		case *ast.AssignStmt:
+			if s.Tok == token.DEFINE {
+				return true
+			}
+		}
+	}
+	return false
+}
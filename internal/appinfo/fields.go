@@ -0,0 +1,269 @@
+package appinfo
+
+import (
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// fieldUsage finds the fields of struct types needed by reachable code.  A
+// field is needed if it is referred, i.e. read, written or given in a keyed
+// composite literal, or its struct type is used as a whole: converted to the
+// empty interface where fmt, reflect and encoding/* may see all the fields,
+// converted to another type, compared, used as map keys or given to
+// unsafe.Sizeof and so on.  A type converted to an interface with methods is
+// used as a whole only if the interface is, e.g. its values are converted
+// to the empty interface or compared.  Embedded fields are always needed
+// because they may promote methods.  A value in a positional composite
+// literal makes its field needed only if it may have side effects or its
+// variables would be left unused, otherwise it is dropped with the field.
+type fieldUsage struct {
+	ai   *ApplicationInfo
+	mark func(ast.Node) // marks the node reachable
+	conv *conversions
+
+	decls   map[*ast.Ident]*ast.Field // names of fields => their declarations
+	params  map[types.Object]bool     // parameters, which may be left unused
+	whole   typeutil.Map              // types used as a whole
+	dynamic typeutil.Map              // interfaces with methods => []types.Type converted to them
+}
+
+func newFieldUsage(ai *ApplicationInfo, mark func(ast.Node)) *fieldUsage {
+	fu := &fieldUsage{
+		ai:     ai,
+		mark:   mark,
+		decls:  make(map[*ast.Ident]*ast.Field),
+		params: make(map[types.Object]bool),
+	}
+	fu.conv = newConversions(ai, fu.convert)
+	for _, fields := range ai.index().structs {
+		for _, field := range fields {
+			for _, name := range field.Names {
+				fu.decls[name] = field
+			}
+		}
+	}
+
+	tinfo := ai.TypesInfo()
+	addParams := func(fields *ast.FieldList) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				if obj := tinfo.Defs[name]; obj != nil {
+					fu.params[obj] = true
+				}
+			}
+		}
+	}
+	forEachFile(ai, func(_ *build.Package, f *ast.File) {
+		ast.Inspect(f, func(nd ast.Node) bool {
+			switch nd := nd.(type) {
+			case *ast.FuncDecl:
+				addParams(nd.Recv)
+			case *ast.FuncType:
+				addParams(nd.Params)
+				addParams(nd.Results)
+			}
+			return true
+		})
+	})
+	return fu
+}
+
+// visit finds the fields needed by the reachable node
+func (fu *fieldUsage) visit(nd ast.Node) {
+	fu.conv.visit(nd)
+
+	tinfo := fu.ai.TypesInfo()
+	if expr, ok := nd.(ast.Expr); ok {
+		if t := tinfo.TypeOf(expr); t != nil {
+			if m, ok := t.Underlying().(*types.Map); ok {
+				fu.useWhole(m.Key())
+			}
+		}
+	}
+
+	switch nd := nd.(type) {
+	case *ast.Ident:
+		// the name of the field referred
+		if field := fu.decls[nd]; field != nil {
+			fu.mark(field.Type)
+			if field.Tag != nil {
+				fu.mark(field.Tag)
+			}
+		}
+	case *ast.BinaryExpr:
+		if nd.Op == token.EQL || nd.Op == token.NEQ {
+			fu.useWhole(tinfo.TypeOf(nd.X))
+			fu.useWhole(tinfo.TypeOf(nd.Y))
+		}
+	case *ast.SwitchStmt:
+		if nd.Tag != nil {
+			fu.useWhole(tinfo.TypeOf(nd.Tag))
+		}
+	case *ast.CallExpr:
+		fun := nd.Fun
+		if sel, ok := fun.(*ast.SelectorExpr); ok {
+			fun = sel.Sel
+		}
+		id, ok := fun.(*ast.Ident)
+		if !ok {
+			break
+		}
+		// unsafe.Sizeof, unsafe.Offsetof and so on
+		b, ok := tinfo.Uses[id].(*types.Builtin)
+		if !ok || types.Unsafe.Scope().Lookup(b.Name()) != b {
+			break
+		}
+		for _, arg := range nd.Args {
+			fu.useWhole(tinfo.TypeOf(arg))
+			if sel, ok := arg.(*ast.SelectorExpr); ok {
+				fu.useWhole(tinfo.TypeOf(sel.X))
+			}
+		}
+	case *ast.CompositeLit:
+		t := tinfo.TypeOf(nd)
+		if t == nil {
+			break
+		}
+		if p, ok := t.Underlying().(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			break
+		}
+		for i, elt := range nd.Elts {
+			if _, ok := elt.(*ast.KeyValueExpr); ok || st.NumFields() <= i {
+				break
+			}
+			if !fu.isPure(elt) {
+				if id := fu.ai.index().fields[st.Field(i).Origin()]; id != nil {
+					fu.mark(id)
+				}
+			}
+		}
+	}
+}
+
+// convert records the conversion of a value of the type from to the type to
+func (fu *fieldUsage) convert(from, to types.Type) {
+	if from == nil || to == nil || types.Identical(from, to) {
+		return
+	}
+	if _, ok := from.(*types.Tuple); ok {
+		return
+	}
+	if b, ok := from.(*types.Basic); ok && b.Info()&types.IsUntyped != 0 {
+		// e.g. nil for pointers
+		return
+	}
+	if iface, ok := to.Underlying().(*types.Interface); ok && iface.NumMethods() > 0 && fu.whole.At(to) == nil {
+		// the values are seen as a whole when the interface is
+		ts, _ := fu.dynamic.At(to).([]types.Type)
+		fu.dynamic.Set(to, append(ts, from))
+		return
+	}
+	fu.useWhole(from)
+	if !types.IsInterface(to) {
+		fu.useWhole(to)
+	}
+}
+
+// useWhole marks all the fields of the struct types in the type t
+func (fu *fieldUsage) useWhole(t types.Type) {
+	if t == nil || fu.whole.At(t) != nil {
+		return
+	}
+	fu.whole.Set(t, true)
+	if ts, ok := fu.dynamic.At(t).([]types.Type); ok {
+		for _, t := range ts {
+			fu.useWhole(t)
+		}
+	}
+
+	switch t := t.(type) {
+	case *types.Alias:
+		fu.useWhole(types.Unalias(t))
+	case *types.Named:
+		for _, field := range fu.ai.index().structs[t.Origin().Obj()] {
+			for _, name := range field.Names {
+				fu.mark(name)
+			}
+		}
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			fu.useWhole(t.TypeArgs().At(i))
+		}
+		fu.useWhole(t.Underlying())
+	case *types.Pointer:
+		fu.useWhole(t.Elem())
+	case *types.Slice:
+		fu.useWhole(t.Elem())
+	case *types.Array:
+		fu.useWhole(t.Elem())
+	case *types.Chan:
+		fu.useWhole(t.Elem())
+	case *types.Map:
+		fu.useWhole(t.Key())
+		fu.useWhole(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			fu.useWhole(t.Field(i).Type())
+		}
+	}
+}
+
+// isPure reports whether evaluating the expr never has side effects
+// including panics, and it refers no imported packages nor local variables
+// declared outside it, other than parameters, which would be left unused
+// without it.  It is conservative; false may be returned for pure ones.
+func (fu *fieldUsage) isPure(expr ast.Expr) bool {
+	tinfo := fu.ai.TypesInfo()
+	var referred bool
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if id, ok := node.(*ast.Ident); ok {
+			switch obj := tinfo.Uses[id].(type) {
+			case *types.PkgName:
+				referred = true
+			case *types.Var:
+				// e.g. captured by a function literal
+				outside := obj.Pos() < expr.Pos() || expr.End() <= obj.Pos()
+				if !obj.IsField() && !fu.params[obj] && obj.Pkg() != nil && obj.Parent() != obj.Pkg().Scope() && outside {
+					referred = true
+				}
+			}
+		}
+		return !referred
+	})
+	if referred {
+		return false
+	}
+	if tv, ok := tinfo.Types[expr]; ok && tv.Value != nil {
+		return true
+	}
+	switch expr := expr.(type) {
+	case *ast.BasicLit, *ast.FuncLit, *ast.Ident:
+		return true
+	case *ast.ParenExpr:
+		return fu.isPure(expr.X)
+	case *ast.UnaryExpr:
+		return expr.Op != token.ARROW && fu.isPure(expr.X)
+	case *ast.CompositeLit:
+		for _, elt := range expr.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if !fu.isPure(kv.Key) || !fu.isPure(kv.Value) {
+					return false
+				}
+			} else if !fu.isPure(elt) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
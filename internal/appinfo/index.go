@@ -0,0 +1,152 @@
+package appinfo
+
+import (
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+)
+
+// index keeps mappings built by a single pass over all files of the
+// application so that ApplicationInfo answers queries without walking files.
+type index struct {
+	// nodes maps every node to the file and the package containing it
+	nodes map[ast.Node]nodeInfo
+
+	// the followings are only for non-standard packages
+
+	decls   map[*ast.Ident]ast.Node           // name => XDecl or XSpec defining it
+	funcs   map[*ast.Ident]*ast.FuncDecl      // name => FuncDecl
+	methods map[types.Object][]*ast.Ident     // receiver type => names of methods
+	vars    map[*ast.Ident]bool               // names of package-level vars
+	consts  map[*ast.ValueSpec]*ast.ValueSpec // const spec without values => the spec whose values it repeats
+	fields  map[*types.Var]*ast.Ident         // fields of the struct types of type specs => their names
+	structs map[types.Object][]*ast.Field     // struct types of type specs => their fields
+	inits   []*ast.FuncDecl                   // init functions
+
+	entryPoint *ast.FuncDecl
+}
+
+type nodeInfo struct {
+	file *ast.File
+	pkg  *build.Package
+}
+
+// index returns the index of ai building it on the first call
+func (ai *ApplicationInfo) index() *index {
+	if ai.idx != nil {
+		return ai.idx
+	}
+
+	idx := &index{
+		nodes:   make(map[ast.Node]nodeInfo),
+		decls:   make(map[*ast.Ident]ast.Node),
+		funcs:   make(map[*ast.Ident]*ast.FuncDecl),
+		methods: make(map[types.Object][]*ast.Ident),
+		vars:    make(map[*ast.Ident]bool),
+		consts:  make(map[*ast.ValueSpec]*ast.ValueSpec),
+		fields:  make(map[*types.Var]*ast.Ident),
+		structs: make(map[types.Object][]*ast.Field),
+	}
+	for _, p := range ai.AllPackages() {
+		for _, f := range ai.GetAstFiles(p) {
+			ni := nodeInfo{file: f, pkg: p}
+			ast.Inspect(f, func(node ast.Node) bool {
+				idx.nodes[node] = ni
+				return true
+			})
+			if ai.IsExternal(p) {
+				continue
+			}
+			for _, decl := range f.Decls {
+				switch decl := decl.(type) {
+				case *ast.GenDecl:
+					idx.addGenDecl(ai.TypesInfo(), decl)
+				case *ast.FuncDecl:
+					idx.addFuncDecl(ai.TypesInfo(), decl)
+					if p == ai.Root() && decl.Name.Name == ai.entrypointName && decl.Recv == nil {
+						idx.entryPoint = decl
+					}
+				}
+			}
+		}
+	}
+
+	ai.idx = idx
+	return idx
+}
+
+func (idx *index) addGenDecl(tinfo *types.Info, decl *ast.GenDecl) {
+	switch decl.Tok {
+	case token.IMPORT:
+		for _, spec := range decl.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if spec.Name != nil {
+				idx.decls[spec.Name] = spec
+			}
+		}
+	case token.CONST, token.VAR:
+		var last *ast.ValueSpec
+		for _, spec := range decl.Specs {
+			spec := spec.(*ast.ValueSpec)
+			if decl.Tok == token.CONST {
+				if 0 < len(spec.Values) {
+					last = spec
+				} else if last != nil {
+					idx.consts[spec] = last
+				}
+			}
+			for _, name := range spec.Names {
+				idx.decls[name] = spec
+				if decl.Tok == token.VAR {
+					idx.vars[name] = true
+				}
+			}
+		}
+	case token.TYPE:
+		for _, spec := range decl.Specs {
+			spec := spec.(*ast.TypeSpec)
+			idx.decls[spec.Name] = spec
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			tobj := tinfo.Defs[spec.Name]
+			idx.structs[tobj] = st.Fields.List
+			for _, field := range st.Fields.List {
+				for _, name := range field.Names {
+					if v, ok := tinfo.Defs[name].(*types.Var); ok {
+						idx.fields[v] = name
+					}
+				}
+			}
+		}
+	}
+}
+
+func (idx *index) addFuncDecl(tinfo *types.Info, decl *ast.FuncDecl) {
+	idx.decls[decl.Name] = decl
+	idx.funcs[decl.Name] = decl
+	if decl.Recv == nil {
+		if decl.Name.Name == "init" {
+			idx.inits = append(idx.inits, decl)
+		}
+		return
+	}
+
+	// the first identifier in the receiver type is the type name, e.g. T of *T[K]
+	var tid *ast.Ident
+	ast.Inspect(decl.Recv.List[0].Type, func(node ast.Node) bool {
+		if tid != nil {
+			return false
+		}
+		tid, _ = node.(*ast.Ident)
+		return tid == nil
+	})
+	if tid == nil {
+		return
+	}
+	if robj := tinfo.Uses[tid]; robj != nil {
+		idx.methods[robj] = append(idx.methods[robj], decl.Name)
+	}
+}
@@ -0,0 +1,175 @@
+package appinfo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// GetSideEffectRoots returns the nodes which are kept for their side effects
+// even if the entry point doesn't reach them:
+//
+//   - *ast.ValueSpec of package-level vars whose values call functions, and
+//     of blank vars such as `var _ I = (*T)(nil)` checking types
+//   - *ast.FuncDecl of init functions in blank-imported packages
+//   - *ast.ImportSpec of blank imports of external packages
+func (ai *ApplicationInfo) GetSideEffectRoots() []ast.Node {
+	if ai.roots != nil {
+		return ai.roots
+	}
+	tinfo := ai.TypesInfo()
+
+	roots := []ast.Node{}
+	blanks := make(map[string]bool) // import paths of blank-imported packages
+	forEachFile(ai, func(bp *build.Package, f *ast.File) {
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.ImportSpec:
+					if spec.Name == nil || spec.Name.Name != "_" {
+						continue
+					}
+					path, err := strconv.Unquote(spec.Path.Value)
+					if err != nil || path == "C" {
+						continue
+					}
+					if path == "unsafe" && bp.Goroot {
+						// inlined standard packages import it only for
+						// go:linkname, which is not combined
+						continue
+					}
+					ibp, err := ai.GetBuildPackage(path, bp.ImportPath)
+					if err != nil {
+						continue
+					}
+					if ai.IsExternal(ibp) {
+						roots = append(roots, spec)
+					} else {
+						blanks[ibp.ImportPath] = true
+					}
+				case *ast.ValueSpec:
+					if decl.Tok != token.VAR {
+						continue
+					}
+					if isBlank(spec.Names) || hasCall(tinfo, spec.Values) {
+						roots = append(roots, spec)
+					}
+				}
+			}
+		}
+	})
+
+	for _, bp := range ai.Packages() {
+		if !blanks[bp.ImportPath] {
+			continue
+		}
+		for _, f := range ai.GetAstFiles(bp) {
+			for _, decl := range f.Decls {
+				if decl, ok := decl.(*ast.FuncDecl); ok && ai.IsInit(decl.Name) {
+					roots = append(roots, decl)
+				}
+			}
+		}
+	}
+
+	ai.roots = roots
+	return roots
+}
+
+// hasCall reports whether evaluating the exprs calls any function, except
+// conversions and builtins without side effects
+func hasCall(tinfo *types.Info, exprs []ast.Expr) bool {
+	var found bool
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.FuncLit:
+				// not called unless it is the Fun of a CallExpr
+				return false
+			case *ast.CallExpr:
+				found = found || isCall(tinfo, node)
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// isCall reports whether the call expr calls a function which may have side
+// effects
+func isCall(tinfo *types.Info, call *ast.CallExpr) bool {
+	if isType(tinfo, call.Fun) {
+		// conversion
+		return false
+	}
+	fun := ast.Unparen(call.Fun)
+	if sel, ok := fun.(*ast.SelectorExpr); ok {
+		fun = sel.Sel
+	}
+	id, ok := fun.(*ast.Ident)
+	if !ok {
+		return true
+	}
+	b, ok := tinfo.Uses[id].(*types.Builtin)
+	if !ok {
+		return true
+	}
+	switch b.Name() {
+	case "panic", "print", "println", "close", "delete", "copy", "clear":
+		return true
+	}
+	return false
+}
+
+// isType reports whether the expr denotes a type.  It looks up the names
+// in tinfo.Uses since the packages restored from the disk cache lack
+// tinfo.Types.
+func isType(tinfo *types.Info, expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return isType(tinfo, expr.X)
+	case *ast.StarExpr:
+		return isType(tinfo, expr.X)
+	case *ast.IndexExpr:
+		// instantiation of a generic type
+		return isType(tinfo, expr.X)
+	case *ast.IndexListExpr:
+		return isType(tinfo, expr.X)
+	case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType, *ast.StructType:
+		return true
+	case *ast.Ident:
+		_, ok := tinfo.Uses[expr].(*types.TypeName)
+		return ok
+	case *ast.SelectorExpr:
+		_, ok := tinfo.Uses[expr.Sel].(*types.TypeName)
+		return ok
+	}
+	return false
+}
+
+// DescribeSideEffectRoot returns the position and the description of the
+// node returned by GetSideEffectRoots() for listing them.
+func (ai *ApplicationInfo) DescribeSideEffectRoot(nd ast.Node) string {
+	var desc string
+	switch nd := nd.(type) {
+	case *ast.ValueSpec:
+		names := make([]string, len(nd.Names))
+		for i, id := range nd.Names {
+			names[i] = id.Name
+		}
+		desc = "var " + strings.Join(names, ", ")
+	case *ast.FuncDecl:
+		desc = "func init of blank-imported " + ai.GetPackage(nd).ImportPath
+	case *ast.ImportSpec:
+		desc = "import _ " + nd.Path.Value
+	}
+	return fmt.Sprintf("%s: %s", ai.FileSet().Position(nd.Pos()), desc)
+}
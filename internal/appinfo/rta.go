@@ -0,0 +1,143 @@
+package appinfo
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// rta finds methods needed by reachable code like the rapid type analysis.
+// A method is reachable if it is referred directly, which the reachability
+// analysis of IsUsed() follows, or it is in the method set of an interface
+// which its type is converted to in reachable code.  The values in an
+// interface flow into the interfaces which it is converted or asserted to,
+// so their types keep the methods of those as well.  External packages
+// can't be followed, so the types converted to the empty interface or error
+// keep the methods which the standard packages look up by reflection or
+// type assertions, see dynamicMethods.
+type rta struct {
+	ai   *ApplicationInfo
+	mark func(ast.Node) // marks the node reachable
+
+	methods map[types.Object]*ast.Ident // method => its name in the FuncDecl
+	conv    *conversions
+
+	values typeutil.Map // interfaces => *typeutil.Map of the concrete types in them
+	succs  typeutil.Map // interfaces => []types.Type of the interfaces they are converted to
+	msets  typeutil.MethodSetCache
+}
+
+// dynamicMethods are the names of methods which the standard packages call
+// on the values of the empty interface or error without the static types,
+// e.g. String() in fmt and Unwrap() in errors.  Others, e.g. MarshalJSON()
+// for encoding/json, are not kept.
+var dynamicMethods = map[string]bool{
+	"String":   true,
+	"Error":    true,
+	"Format":   true,
+	"GoString": true,
+	"Unwrap":   true,
+	"Is":       true,
+	"As":       true,
+}
+
+func newRTA(ai *ApplicationInfo, mark func(ast.Node)) *rta {
+	r := &rta{
+		ai:      ai,
+		mark:    mark,
+		methods: make(map[types.Object]*ast.Ident),
+	}
+	r.conv = newConversions(ai, r.convert)
+	tinfo := ai.TypesInfo()
+	for id, decl := range ai.index().funcs {
+		if decl.Recv != nil {
+			if obj := tinfo.Defs[id]; obj != nil {
+				r.methods[obj] = id
+			}
+		}
+	}
+	return r
+}
+
+// visit finds conversions to interfaces in the reachable node
+func (r *rta) visit(nd ast.Node) {
+	r.conv.visit(nd)
+}
+
+// convert records the conversion of a value of the type from to the type to
+func (r *rta) convert(from, to types.Type) {
+	if from == nil || to == nil || !types.IsInterface(to) || types.Identical(from, to) {
+		return
+	}
+	if _, ok := from.(*types.Tuple); ok {
+		return
+	}
+	if !types.IsInterface(from) {
+		r.add(from, to)
+		return
+	}
+
+	// the values in from flow into to
+	succs, _ := r.succs.At(from).([]types.Type)
+	for _, t := range succs {
+		if types.Identical(t, to) {
+			return
+		}
+	}
+	r.succs.Set(from, append(succs, to))
+	if values, ok := r.values.At(from).(*typeutil.Map); ok {
+		for _, t := range values.Keys() {
+			r.add(t, to)
+		}
+	}
+}
+
+// add records the value of the concrete type t in the interface iface
+func (r *rta) add(t, iface types.Type) {
+	values, _ := r.values.At(iface).(*typeutil.Map)
+	if values == nil {
+		values = new(typeutil.Map)
+		r.values.Set(iface, values)
+	}
+	if values.At(t) != nil {
+		return
+	}
+	values.Set(t, true)
+
+	r.keepMethods(t, iface.Underlying().(*types.Interface))
+	succs, _ := r.succs.At(iface).([]types.Type)
+	for _, succ := range succs {
+		r.add(t, succ)
+	}
+}
+
+// keepMethods marks the methods of the type t needed by the interface iface
+func (r *rta) keepMethods(t types.Type, iface *types.Interface) {
+	ids := make(map[string]bool)
+	for i := 0; i < iface.NumMethods(); i++ {
+		ids[iface.Method(i).Id()] = true
+	}
+	dynamic := iface.NumMethods() == 0 || ids["Error"]
+
+	ts := []types.Type{t}
+	if _, ok := t.Underlying().(*types.Pointer); !ok {
+		ts = append(ts, types.NewPointer(t))
+	}
+	for _, t := range ts {
+		mset := r.msets.MethodSet(t)
+		for i := 0; i < mset.Len(); i++ {
+			fn, ok := mset.At(i).Obj().(*types.Func)
+			if !ok {
+				continue
+			}
+			fn = fn.Origin()
+			if !ids[fn.Id()] && !(dynamic && fn.Exported() && dynamicMethods[fn.Name()]) {
+				continue
+			}
+			if id := r.methods[fn]; id != nil {
+				r.mark(id)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package appinfo
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/build"
@@ -9,11 +10,13 @@ import (
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
 	"io"
 	"io/ioutil"
 	"math"
 	"path/filepath"
 	"slices"
+	"strconv"
 
 	"strings"
 
@@ -24,6 +27,7 @@ type appInfo interface {
 	PackageInfo
 	HasUsedC(pb *build.Package) bool
 	IsUsed(ast.Node) bool
+	IsUsedField(*types.Var) bool
 	IsMethod(ast.Node) bool
 	IsInit(ast.Node) bool
 	GetEntryPointDecl() *ast.FuncDecl
@@ -121,8 +125,7 @@ func newSquashedApp(ai appInfo) (*SquashedApp, error) {
 		}
 	})
 
-	return ingr.newSquashedApp(ai), nil
-
+	return ingr.newSquashedApp(ai)
 }
 
 // Fprint formats the source code and writes it to the given io.Writer
@@ -212,7 +215,7 @@ type ingredients struct {
 	comments map[ast.Decl][]*ast.CommentGroup // for comments in GenDecls/FuncDecls
 }
 
-func (ingr *ingredients) squashImports(ai appInfo, used map[string]bool) []ast.Decl {
+func (ingr *ingredients) squashImports(ai appInfo, cp *copier, used map[string]bool) ([]ast.Decl, error) {
 	var res []ast.Decl
 
 	// `import "C"` and `import ( ... )`
@@ -230,7 +233,10 @@ func (ingr *ingredients) squashImports(ai appInfo, used map[string]bool) []ast.D
 		idecl.Specs = append(idecl.Specs, s)
 	}
 
-	ispecs := squashImportSpecs(ai, used, ingr.importSpecs)
+	ispecs, err := squashImportSpecs(ai, cp, used, ingr.importSpecs)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, s := range ispecs {
 		idecl.Specs = append(idecl.Specs, s)
@@ -238,7 +244,7 @@ func (ingr *ingredients) squashImports(ai appInfo, used map[string]bool) []ast.D
 	if 0 < len(idecl.Specs) {
 		res = append(res, idecl)
 	}
-	return res
+	return res, nil
 }
 
 func (ingr *ingredients) newUsedNames(ai appInfo) map[string]bool {
@@ -276,8 +282,10 @@ func (ingr *ingredients) newUsedNames(ai appInfo) map[string]bool {
 }
 
 // newSquashedApp populates used items to a single *ast.Node deduping and renameing if needed.
-// Note that the oriiginal ast.Nodes are modified so they are no longer used for rebuilding the original source
-func (ingr *ingredients) newSquashedApp(ai appInfo) *SquashedApp {
+// Note that the original ast.Nodes are kept intact; the used ones are copied
+// and only the copies are modified.  So the original ones can be shared with
+// other applications.
+func (ingr *ingredients) newSquashedApp(ai appInfo) (*SquashedApp, error) {
 	mainPkg := ai.Root()
 
 	res := &SquashedApp{
@@ -285,10 +293,25 @@ func (ingr *ingredients) newSquashedApp(ai appInfo) *SquashedApp {
 		fset:    ai.FileSet(),
 	}
 
+	// copy all nodes to be modified in advance, renaming an identity
+	// modifies the identities referring it in any declaration
+	cp := newCopier()
+	copies := make(map[ast.Decl]ast.Decl)
+	for _, d := range ingr.decls {
+		copies[d] = cp.copyDecl(d)
+	}
+	for _, s := range ingr.importSpecs {
+		cp.copyImportSpec(s)
+	}
+
 	// memo for used identity in the target file
 	used := ingr.newUsedNames(ai)
 
-	res.importDecls = ingr.squashImports(ai, used)
+	importDecls, err := ingr.squashImports(ai, cp, used)
+	if err != nil {
+		return nil, fmt.Errorf("squashing imports: %w", err)
+	}
+	res.importDecls = importDecls
 
 	var mainDecls, otherDecls []ast.Decl
 	for _, d := range ingr.decls {
@@ -302,19 +325,37 @@ func (ingr *ingredients) newSquashedApp(ai appInfo) *SquashedApp {
 		for _, d := range decls {
 			switch d := d.(type) {
 			case *ast.GenDecl:
-				renameGenDecl(ai, used, d)
+				renameGenDecl(ai, cp, used, d)
 			case *ast.FuncDecl:
-				renameFuncDecl(ai, used, d)
+				renameFuncDecl(ai, cp, used, d)
 				if d.Body == nil {
-					fixupExternFuncDecl(ai.GetPackage(d).Name, d)
+					fixupExternFuncDecl(ai.GetPackage(d).Name, copies[d].(*ast.FuncDecl))
 				}
 			}
 		}
 	}
-	res.decls = removeInvalidSelector(ingr.decls)
-	res.comments = ingr.comments
 
-	return res
+	decls := make([]ast.Decl, 0, len(ingr.decls))
+	res.comments = make(map[ast.Decl][]*ast.CommentGroup)
+	for _, d := range ingr.decls {
+		c := copies[d]
+		var removed []ast.Node
+		if d, ok := d.(*ast.GenDecl); ok {
+			removed = pruneGenDecl(ai, cp, d, c.(*ast.GenDecl))
+		}
+		removed = append(removed, pruneFields(ai, cp, d)...)
+		removed = append(removed, pruneDeadBranches(ai, cp, d)...)
+		decls = append(decls, c)
+		for _, cg := range ingr.comments[d] {
+			if inNodes(cg, removed) {
+				continue
+			}
+			res.comments[c] = append(res.comments[c], cp.commentGroup(cg))
+		}
+	}
+	res.decls = removeInvalidSelector(decls)
+
+	return res, nil
 }
 
 // fixupExternFuncDecl adds stub body for extern functions, typically
@@ -381,7 +422,7 @@ func removeInvalidSelector(decls []ast.Decl) []ast.Decl {
 }
 
 // rename function name if needed.
-func renameFuncDecl(ai appInfo, used map[string]bool, decl *ast.FuncDecl) {
+func renameFuncDecl(ai appInfo, cp *copier, used map[string]bool, decl *ast.FuncDecl) {
 	// Methods doesn't need renaming because they are type scope
 	if decl.Recv != nil {
 		return
@@ -396,16 +437,20 @@ func renameFuncDecl(ai appInfo, used map[string]bool, decl *ast.FuncDecl) {
 	}
 	bp := ai.GetPackage(decl)
 	prefix := bp.Name
-	renameIdents(ai, used, prefix, []*ast.Ident{decl.Name})
+	renameIdents(ai, cp, used, prefix, []*ast.Ident{decl.Name})
 }
 
 // rename type, const, var name if needed.
 // It scans all specs in the decl and rename all ident when one of them need
 // renaming.  It is done for readability.
-func renameGenDecl(ai appInfo, used map[string]bool, decl *ast.GenDecl) {
+func renameGenDecl(ai appInfo, cp *copier, used map[string]bool, decl *ast.GenDecl) {
 	var ids []*ast.Ident
 	var needRename bool
-	for _, spec := range decl.Specs {
+	keep := usedSpecs(ai, decl)
+	for i, spec := range decl.Specs {
+		if !keep[i] {
+			continue
+		}
 		switch spec := spec.(type) {
 		case *ast.TypeSpec:
 			id := spec.Name
@@ -413,6 +458,10 @@ func renameGenDecl(ai appInfo, used map[string]bool, decl *ast.GenDecl) {
 			needRename = needRename || used[id.Name]
 		case *ast.ValueSpec:
 			for _, id := range spec.Names {
+				if id.Name == "_" {
+					// blank vars can be duplicated
+					continue
+				}
 				ids = append(ids, id)
 				needRename = needRename || used[id.Name]
 			}
@@ -422,7 +471,7 @@ func renameGenDecl(ai appInfo, used map[string]bool, decl *ast.GenDecl) {
 	if needRename {
 		bp := ai.GetPackage(decl)
 		prefix := bp.Name
-		renameIdents(ai, used, prefix, ids)
+		renameIdents(ai, cp, used, prefix, ids)
 	} else {
 		for _, id := range ids {
 			used[id.Name] = true
@@ -430,8 +479,263 @@ func renameGenDecl(ai appInfo, used map[string]bool, decl *ast.GenDecl) {
 	}
 }
 
+// usedSpecs reports whether each spec of the const, var or type decl is used.
+// Vars named only _ are kept for the side effects of their values.  All the
+// specs are reported as used if none of them is, e.g. the decl is used as a
+// whole.
+func usedSpecs(ai appInfo, decl *ast.GenDecl) []bool {
+	keep := make([]bool, len(decl.Specs))
+	var found bool
+	for i, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			keep[i] = ai.IsUsed(spec)
+		case *ast.ValueSpec:
+			for _, id := range spec.Names {
+				keep[i] = keep[i] || ai.IsUsed(id)
+			}
+		}
+		found = found || keep[i]
+	}
+	for i, spec := range decl.Specs {
+		if spec, ok := spec.(*ast.ValueSpec); ok && decl.Tok == token.VAR && isBlank(spec.Names) {
+			keep[i] = true
+		}
+		keep[i] = keep[i] || !found
+	}
+	return keep
+}
+
+// isBlank reports whether all the ids are _
+func isBlank(ids []*ast.Ident) bool {
+	for _, id := range ids {
+		if id.Name != "_" {
+			return false
+		}
+	}
+	return true
+}
+
+// pruneGenDecl removes the specs which are not used from the copy c of the
+// decl and returns the removed ones.  The kept const specs are rewritten to
+// have the same values: a spec repeating the values of a removed one gets a
+// copy of them, and iota in them is offset by the number of the removed specs
+// before it, e.g. B and C of
+//
+//	const (
+//		_ = iota
+//		A
+//		B
+//		C
+//	)
+//
+// where only B and C are used turn to
+//
+//	const (
+//		B = iota + 2
+//		C
+//	)
+func pruneGenDecl(ai appInfo, cp *copier, decl, c *ast.GenDecl) []ast.Node {
+	keep := usedSpecs(ai, decl)
+	if !slices.Contains(keep, false) {
+		return nil
+	}
+
+	// the copies of iota in the decl
+	iota := types.Universe.Lookup("iota")
+	iotas := make(map[*ast.Ident]bool)
+	ast.Inspect(decl, func(node ast.Node) bool {
+		if id, ok := node.(*ast.Ident); ok && ai.TypesInfo().Uses[id] == iota {
+			iotas[cp.ident(id)] = true
+		}
+		return true
+	})
+
+	var specs []ast.Spec
+	var removed []ast.Node
+	var srcType ast.Expr // type of the last const spec with values
+	var srcValues []ast.Expr
+	src, prevSrc, prevOffset := -1, -1, 0
+	for i, spec := range decl.Specs {
+		cspec := c.Specs[i]
+		vs, isConst := cspec.(*ast.ValueSpec)
+		isConst = isConst && decl.Tok == token.CONST
+		if isConst && 0 < len(vs.Values) {
+			src, srcType, srcValues = i, vs.Type, vs.Values
+		}
+		if !keep[i] {
+			removed = append(removed, spec)
+			continue
+		}
+		if isConst && 0 <= src {
+			offset := 0
+			if hasIdent(srcValues, iotas) {
+				offset = i - len(specs)
+			}
+			if src == i && offset != 0 || src != i && (src != prevSrc || offset != prevOffset) {
+				pos := vs.Names[0].Pos()
+				vs.Type = (&copier{copies: make(map[any]any), pos: pos}).copyExpr(srcType)
+				vs.Values = offsetIota(srcValues, iotas, offset, pos)
+			}
+			prevSrc, prevOffset = src, offset
+		}
+		specs = append(specs, cspec)
+	}
+	c.Specs = specs
+	return removed
+}
+
+// hasIdent reports whether any of the exprs has any of the ids
+func hasIdent(exprs []ast.Expr, ids map[*ast.Ident]bool) bool {
+	var found bool
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(node ast.Node) bool {
+			id, ok := node.(*ast.Ident)
+			found = found || ok && ids[id]
+			return !found
+		})
+	}
+	return found
+}
+
+// offsetIota returns copies of the exprs at the pos replacing the iotas in
+// them with iota + offset
+func offsetIota(exprs []ast.Expr, iotas map[*ast.Ident]bool, offset int, pos token.Pos) []ast.Expr {
+	var res []ast.Expr
+	for _, expr := range exprs {
+		cp := &copier{copies: make(map[any]any), pos: pos}
+		c := cp.copyExpr(expr)
+		if offset != 0 {
+			replaced := make(map[*ast.Ident]bool)
+			for id := range iotas {
+				if cid := cp.ident(id); cid != nil {
+					replaced[cid] = true
+				}
+			}
+			added := func() *ast.BinaryExpr {
+				return &ast.BinaryExpr{
+					X:     &ast.Ident{NamePos: pos, Name: "iota"},
+					OpPos: pos,
+					Op:    token.ADD,
+					Y:     &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: strconv.Itoa(offset)},
+				}
+			}
+			if id, ok := c.(*ast.Ident); ok && replaced[id] {
+				c = added()
+			} else {
+				c = astutil.Apply(c, func(cur *astutil.Cursor) bool {
+					if id, ok := cur.Node().(*ast.Ident); !ok || !replaced[id] {
+						return true
+					}
+					if _, ok := cur.Parent().(*ast.ParenExpr); ok {
+						cur.Replace(added())
+					} else {
+						cur.Replace(&ast.ParenExpr{Lparen: pos, X: added(), Rparen: pos})
+					}
+					return true
+				}, nil).(ast.Expr)
+			}
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// pruneFields removes the fields which are not used from the struct types of
+// the type specs in the copy of the decl, and the values for them from the
+// positional composite literals.  It returns the removed fields.
+func pruneFields(ai appInfo, cp *copier, decl ast.Decl) []ast.Node {
+	tinfo := ai.TypesInfo()
+	var removed []ast.Node
+	ast.Inspect(decl, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.TypeSpec:
+			st, ok := node.Type.(*ast.StructType)
+			if !ok {
+				break
+			}
+			cst := cp.copies[st].(*ast.StructType)
+			var fields []*ast.Field
+			for i, field := range st.Fields.List {
+				cfield := cst.Fields.List[i]
+				if len(field.Names) == 0 {
+					fields = append(fields, cfield)
+					continue
+				}
+				var names []*ast.Ident
+				for j, name := range field.Names {
+					if v, ok := tinfo.Defs[name].(*types.Var); !ok || ai.IsUsedField(v) {
+						names = append(names, cfield.Names[j])
+					}
+				}
+				if len(names) == 0 {
+					removed = append(removed, field)
+					continue
+				}
+				cfield.Names = names
+				fields = append(fields, cfield)
+			}
+			cst.Fields.List = fields
+		case *ast.CompositeLit:
+			t := tinfo.TypeOf(node)
+			if t == nil || len(node.Elts) == 0 {
+				break
+			}
+			if p, ok := t.Underlying().(*types.Pointer); ok {
+				// elided &T in an element
+				t = p.Elem()
+			}
+			st, ok := t.Underlying().(*types.Struct)
+			if !ok {
+				break
+			}
+			if _, ok := node.Elts[0].(*ast.KeyValueExpr); ok {
+				break
+			}
+			clit := cp.copies[node].(*ast.CompositeLit)
+			var elts []ast.Expr
+			for i := range node.Elts {
+				if i < st.NumFields() && !ai.IsUsedField(st.Field(i)) {
+					continue
+				}
+				elts = append(elts, clit.Elts[i])
+			}
+			clit.Elts = elts
+		}
+		return true
+	})
+	return removed
+}
+
+// inNodes reports whether the comment group is in any of the nodes, which
+// are specs, fields or statements, including their comments
+func inNodes(cg *ast.CommentGroup, nodes []ast.Node) bool {
+	for _, node := range nodes {
+		start, end := node.Pos(), node.End()
+		var doc, comment *ast.CommentGroup
+		switch node := node.(type) {
+		case *ast.ValueSpec:
+			doc, comment = node.Doc, node.Comment
+		case *ast.TypeSpec:
+			doc, comment = node.Doc, node.Comment
+		case *ast.Field:
+			doc, comment = node.Doc, node.Comment
+		}
+		if doc != nil {
+			start = doc.Pos()
+		}
+		if comment != nil {
+			end = comment.End()
+		}
+		if start <= cg.Pos() && cg.End() <= end {
+			return true
+		}
+	}
+	return false
+}
+
 // Rename a set of identities specified by the given ids adding the same name prefix
-func renameIdents(ai appInfo, used map[string]bool, prefix string, ids []*ast.Ident) {
+func renameIdents(ai appInfo, cp *copier, used map[string]bool, prefix string, ids []*ast.Ident) {
 	// Find the safe prefix for the identifiers.
 	// Initially the prefx candidate is package name, e.g. "foo".
 	// When the candidate is not safe, add 'x' to the prefix, e.g. "xfoo"
@@ -450,8 +754,8 @@ func renameIdents(ai appInfo, used map[string]bool, prefix string, ids []*ast.Id
 	}
 
 	for i, id := range ids {
-		id.Name = tns[i]
-		renameRefererOfIdent(ai, id, tns[i])
+		cp.rename(id, tns[i])
+		renameRefererOfIdent(ai, cp, id, tns[i])
 		used[tns[i]] = true
 	}
 }
@@ -550,24 +854,33 @@ import "C"
 	return decl.Decls[0].(*ast.GenDecl), nil
 }
 
-func squashImportSpecs(ai appInfo, used map[string]bool, specs []*ast.ImportSpec) []*ast.ImportSpec {
+// ErrNotInlinable is wrapped by the errors of standard packages which cannot
+// be combined into the application.
+var ErrNotInlinable = errors.New("cannot be inlined")
+
+func squashImportSpecs(ai appInfo, cp *copier, used map[string]bool, specs []*ast.ImportSpec) ([]*ast.ImportSpec, error) {
 	collected := make(map[string]bool)
 	var res []*ast.ImportSpec
 	for i, spec := range specs {
 		path := strings.Trim(spec.Path.Value, `"`)
-		f := ai.GetFile(spec)
-		bp := ai.GetBuildPackage(path, f.Name.Name)
-		if bp == nil {
-			panic(fmt.Sprintf("unknown package: %s", path))
+		importer := ai.GetPackage(spec)
+		bp, err := ai.GetBuildPackage(path, importer.ImportPath)
+		if err != nil {
+			return nil, fmt.Errorf("unknown package: %s: %w", path, err)
 		}
 
-		// non-standard packages will be embedded into the target source file
-		if !bp.Goroot {
+		// non-external packages will be embedded into the target source file
+		if !ai.IsExternal(bp) {
 			// *ast.SelectorExpr using this empty name will be replaced by its .Sel. later
-			renameRefererOfImportSpec(ai, spec, "")
+			renameRefererOfImportSpec(ai, cp, spec, "")
 			continue
 		}
 
+		// internal packages can't be imported by the application
+		if importer.Goroot && isInternalPath(path) {
+			return nil, fmt.Errorf("%s %w: it uses %s", importer.ImportPath, ErrNotInlinable, path)
+		}
+
 		if collected[path] {
 			continue
 		}
@@ -585,6 +898,17 @@ func squashImportSpecs(ai appInfo, used map[string]bool, specs []*ast.ImportSpec
 			sames = append(sames, specs[j])
 		}
 
+		c := cp.copyImportSpec(spec)
+		if bp.ImportPath != path && !bp.Goroot {
+			// replaced by another package
+			c.Path = &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(bp.ImportPath)}
+		}
+		if isBlankImport(sames) {
+			// kept for the side effects
+			res = append(res, c)
+			continue
+		}
+
 		name := candidate
 		for used[name] {
 			name = "x" + name
@@ -592,54 +916,63 @@ func squashImportSpecs(ai appInfo, used map[string]bool, specs []*ast.ImportSpec
 		used[name] = true
 
 		for _, sp := range sames {
-			renameRefererOfImportSpec(ai, sp, name)
+			renameRefererOfImportSpec(ai, cp, sp, name)
 		}
 
 		if spec.Name == nil {
 			obj := ai.TypesInfo().Implicits[spec]
 			if obj.Name() != name {
-				spec.Name = &ast.Ident{
+				c.Name = &ast.Ident{
 					NamePos: token.NoPos,
 					Name:    name,
 				}
 			}
 		} else if spec.Name.Name != name {
 			if bp.Name == name {
-				spec.Name = nil
+				c.Name = nil
 			} else {
-				spec.Name.Name = name
+				c.Name.Name = name
 			}
 		}
-		res = append(res, spec)
+		res = append(res, c)
 	}
-	return res
+	return res, nil
+}
+
+// isBlankImport reports whether all the specs are blank imports
+func isBlankImport(specs []*ast.ImportSpec) bool {
+	for _, spec := range specs {
+		if spec.Name == nil || spec.Name.Name != "_" {
+			return false
+		}
+	}
+	return true
+}
+
+// isInternalPath reports whether the import path has an "internal" element
+func isInternalPath(path string) bool {
+	return slices.Contains(strings.Split(path, "/"), "internal")
 }
 
 // rename the name of identities referring the given spec.
-func renameRefererOfImportSpec(ai appInfo, spec *ast.ImportSpec, to string) {
+func renameRefererOfImportSpec(ai appInfo, cp *copier, spec *ast.ImportSpec, to string) {
 	if spec.Name != nil {
-		renameRefererOfIdent(ai, spec.Name, to)
+		renameRefererOfIdent(ai, cp, spec.Name, to)
 		return
 	}
 	for _, uid := range ai.GetReferrings(spec) {
-		if uid.Name == to {
-			continue
-		}
-		uid.Name = to
+		cp.rename(uid, to)
 	}
 }
 
 // rename the name of identities referring the given id.
-func renameRefererOfIdent(ai appInfo, id *ast.Ident, to string) {
+func renameRefererOfIdent(ai appInfo, cp *copier, id *ast.Ident, to string) {
 	for _, uid := range ai.GetReferrings(id) {
-		if uid.Name == to {
-			continue
-		}
-		uid.Name = to
+		cp.rename(uid, to)
 	}
 }
 
-// call f() for each *ast.File in all packages except standard ones.
+// call f() for each *ast.File in all packages except external ones.
 func forEachFile(ai PackageInfo, fn func(bp *build.Package, f *ast.File)) {
 	for _, bp := range ai.Packages() {
 		for _, f := range ai.GetAstFiles(bp) {
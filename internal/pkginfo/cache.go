@@ -0,0 +1,615 @@
+package pkginfo
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache keeps *build.Package, parsed files and type-checked packages to share
+// them among PackageInfos of different applications loaded with the same
+// Config.  A package is loaded again when any of its files or the packages it
+// imports have been changed.
+// It is safe for concurrent use by multiple goroutines.
+type Cache struct {
+	cfg  Config
+	ctxt *build.Context // the target of the application
+	fset *token.FileSet // shared by all packages in the cache
+
+	// findCtxt is ctxt for finding non-standard packages.  go/build asks
+	// the go command for them only with the local GOROOT and release tags,
+	// and without the hooks reading files, i.e. of Overlay and FS.
+	findCtxt *build.Context
+
+	files *vfs // nil if the sources are read from the disk as is
+
+	// stdMu guards std and the standard packages imported by it which are
+	// completed lazily, also by reading export data from the disk.
+	stdMu sync.Mutex
+	std   *exportImporter // importer for standard packages if cfg.StdExportData
+
+	disk *diskCache // nil unless cfg.CacheDir
+
+	goVersion string // language version of the target
+
+	mu      sync.Mutex
+	dirs    map[pkgKey]string                  // (importPath, dir) => abs path of the imported package
+	bpkgs   map[pkgKey]*cachedBuildPackage     // (importPath, abs) => *build.Package
+	checked map[*build.Package]*checkedPackage // *build.Package => type-checked package
+	keys    map[*types.Package]string          // checked package => key in the disk
+}
+
+// cachedBuildPackage is a *build.Package with the states of its files
+type cachedBuildPackage struct {
+	bp     *build.Package
+	stamps []fileStamp
+}
+
+// fileStamp is the state of a file or a directory for detecting changes
+type fileStamp struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// checkedPackage is a parsed and type-checked package
+type checkedPackage struct {
+	done chan struct{} // closed when the checking is completed
+	err  error
+
+	tp    *types.Package
+	files []*ast.File
+	info  *types.Info
+
+	// imports are the imported packages on checking.
+	// The package must be checked again if one of them has been changed.
+	imports []*types.Package
+
+	key string // key in the disk cache if enabled
+}
+
+// NewCache creates Cache for the given cfg
+func NewCache(cfg Config) *Cache {
+	return newCache(cfg, token.NewFileSet())
+}
+
+func newCache(cfg Config, fset *token.FileSet) *Cache {
+	c := &Cache{
+		cfg:     cfg,
+		ctxt:    cfg.buildContext(),
+		fset:    fset,
+		dirs:    make(map[pkgKey]string),
+		bpkgs:   make(map[pkgKey]*cachedBuildPackage),
+		checked: make(map[*build.Package]*checkedPackage),
+		keys:    make(map[*types.Package]string),
+
+		goVersion: cfg.goVersion(),
+		files:     newVFS(cfg.Overlay, cfg.FS),
+	}
+	fctxt := *c.ctxt
+	fctxt.GOROOT = build.Default.GOROOT
+	fctxt.ReleaseTags = build.Default.ReleaseTags
+	c.findCtxt = &fctxt
+	c.files.setup(c.ctxt)
+	if cfg.StdExportData && cfg.GOROOT == "" && len(cfg.Inline) == 0 {
+		c.std = newExportImporter(c.ctxt, fset)
+	}
+	if cfg.CacheDir != "" {
+		c.disk = newDiskCache(cfg.CacheDir, &cfg, c.ctxt, c.files)
+	}
+	return c
+}
+
+// FileSet returns the *token.FileSet shared by all packages in the cache.
+func (c *Cache) FileSet() *token.FileSet {
+	return c.fset
+}
+
+// BuildContext returns the build.Context reading packages of the target.  It
+// selects the files of packages by GOOS, GOARCH, build tags and the release
+// tags of the Go version, ignoring sources combined by gottani.
+func (c *Cache) BuildContext() *build.Context {
+	ctxt := *c.ctxt
+	// sources combined by gottani may be written in the package
+	ctxt.ReadDir = func(dir string) ([]fs.FileInfo, error) {
+		fis, err := c.files.readDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		res := fis[:0]
+		for _, fi := range fis {
+			if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".go") || !c.files.isCombined(filepath.Join(dir, fi.Name())) {
+				res = append(res, fi)
+			}
+		}
+		return res, nil
+	}
+	return &ctxt
+}
+
+// findDir finds abs path of the package pointed by the given importPath on the given dir.
+func (c *Cache) findDir(importPath, dir string) (string, error) {
+	key := pkgKey{importPath, dir}
+	c.mu.Lock()
+	abs, ok := c.dirs[key]
+	c.mu.Unlock()
+	if ok && c.files.isDir(abs) {
+		return abs, nil
+	}
+
+	abs, err := c.resolveDir(importPath, dir)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.dirs[key] = abs
+	c.mu.Unlock()
+	return abs, nil
+}
+
+// resolveDir finds abs path of the package without the memory cache.
+func (c *Cache) resolveDir(importPath, dir string) (string, error) {
+	standard := c.isStandard(importPath, dir)
+	if c.files.hasFS() {
+		// it doesn't need the go command nor the disk cache
+		abs, err := c.files.findDir(importPath, standard)
+		if err != nil || abs != "" {
+			return abs, err
+		}
+	}
+
+	if c.cfg.Vendor && !standard {
+		return findVendorDir(importPath, dir)
+	}
+	if standard {
+		return getImportDirAbs(c.ctxt, importPath, dir)
+	}
+
+	var diskKey string
+	if c.disk != nil {
+		diskKey, _ = c.disk.dirKey(importPath, dir)
+	}
+	if diskKey != "" {
+		if abs, ok := c.disk.getDir(diskKey); ok && c.files.isDir(abs) {
+			return abs, nil
+		}
+	}
+	abs, err := getImportDirAbs(c.findCtxt, importPath, dir)
+	if err != nil {
+		return "", err
+	}
+	if diskKey != "" {
+		c.disk.putDir(diskKey, abs) // the cache is best-effort
+	}
+	return abs, nil
+}
+
+// importDir returns *build.Package for the package in the abs dir.
+// The importPath of the result is replaced with the given one unless it is empty.
+func (c *Cache) importDir(importPath, abs string) (*build.Package, error) {
+	return c.importPackage(pkgKey{importPath, abs}, func() (*build.Package, error) {
+		bp, err := c.BuildContext().ImportDir(abs, build.AllowBinary)
+		if err != nil {
+			return nil, err
+		}
+		if importPath != "" {
+			bp.ImportPath = importPath
+		}
+		return bp, nil
+	})
+}
+
+// importFiles returns *build.Package for the package consisting of the given
+// files like `go run file.go`.  Their build constraints are ignored.
+func (c *Cache) importFiles(paths []string) (*build.Package, error) {
+	var dir string
+	names := make(map[string]bool)
+	for _, path := range paths {
+		abs, err := c.files.abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("getting absolute path %q: %w", path, err)
+		}
+		if !strings.HasSuffix(abs, ".go") {
+			return nil, fmt.Errorf("%s: not a .go file", path)
+		}
+		if dir == "" {
+			dir = filepath.Dir(abs)
+		} else if filepath.Dir(abs) != dir {
+			return nil, fmt.Errorf("named files must all be in one directory; have %s and %s", dir, filepath.Dir(abs))
+		}
+		names[filepath.Base(abs)] = true
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no files given")
+	}
+
+	sorted := slices.Sorted(maps.Keys(names))
+	key := pkgKey{"", filepath.Join(dir, strings.Join(sorted, string(filepath.ListSeparator)))}
+	return c.importPackage(key, func() (*build.Package, error) {
+		// go/build reads only the given files in the dir
+		ctxt := *c.ctxt
+		ctxt.UseAllFiles = true
+		ctxt.ReadDir = func(dir string) ([]fs.FileInfo, error) {
+			fis, err := c.files.readDir(dir)
+			if err != nil {
+				return nil, err
+			}
+			var res []fs.FileInfo
+			for _, fi := range fis {
+				if names[fi.Name()] && !fi.IsDir() {
+					res = append(res, fi)
+				}
+			}
+			if len(res) != len(names) {
+				return nil, fmt.Errorf("some of the files %s are not found in %s", strings.Join(sorted, ", "), dir)
+			}
+			return res, nil
+		}
+		return ctxt.ImportDir(dir, build.AllowBinary)
+	})
+}
+
+// importPackage returns *build.Package for the key imported by the given
+// function.  It is imported again if any of its files has been changed.
+func (c *Cache) importPackage(key pkgKey, importFunc func() (*build.Package, error)) (*build.Package, error) {
+	c.mu.Lock()
+	old := c.bpkgs[key]
+	c.mu.Unlock()
+	if old != nil && !changed(old.stamps) {
+		return old.bp, nil
+	}
+
+	bp, err := importFunc()
+	if err != nil {
+		return nil, err
+	}
+	stamps, err := stampPackage(bp, c.files)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cur := c.bpkgs[key]; cur != old {
+		// another goroutine has updated it meanwhile
+		if !changed(cur.stamps) {
+			return cur.bp, nil
+		}
+	}
+	if old != nil {
+		c.forget(old.bp)
+	}
+	c.bpkgs[key] = &cachedBuildPackage{bp: bp, stamps: stamps}
+	return bp, nil
+}
+
+// check returns the parsed and type-checked package for the given bp.
+// The imports must be the packages imported by bp in the order of bp.Imports;
+// they are loaded with imp in advance.
+func (c *Cache) check(bp *build.Package, imp types.ImporterFrom, imports []*types.Package) (*checkedPackage, error) {
+	for {
+		c.mu.Lock()
+		cp, ok := c.checked[bp]
+		if !ok {
+			cp = &checkedPackage{done: make(chan struct{}), imports: imports}
+			c.checked[bp] = cp
+			var importKeys []string
+			if c.disk != nil {
+				for _, tp := range imports {
+					if key, ok := c.keys[tp]; ok {
+						importKeys = append(importKeys, key)
+					} else {
+						importKeys = append(importKeys, tp.Path())
+					}
+				}
+			}
+			c.mu.Unlock()
+
+			cp.tp, cp.files, cp.info, cp.key, cp.err = c.load(bp, imp, imports, importKeys)
+			if cp.key != "" {
+				c.mu.Lock()
+				c.keys[cp.tp] = cp.key
+				c.mu.Unlock()
+			}
+			close(cp.done)
+			return cp, cp.err
+		}
+		c.mu.Unlock()
+
+		<-cp.done
+		if slices.Equal(cp.imports, imports) {
+			return cp, cp.err
+		}
+
+		// the imported packages have been changed since cp was checked
+		c.mu.Lock()
+		if c.checked[bp] == cp {
+			c.forget(bp)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// inlined reports whether the standard package is combined like
+// non-standard ones as given by Config.Inline
+func (c *Cache) inlined(bp *build.Package) bool {
+	return bp.Goroot && bp.ImportPath != "unsafe" && bp != fakeCbpkg && MatchPatterns(c.cfg.Inline, bp.ImportPath)
+}
+
+// IsStandardPath reports whether the importPath is of a package in the
+// standard library of the goroot, or of the local GOROOT if it is empty.
+// Unlike the go command, it doesn't regard every path without dots in its
+// first element as standard, e.g. a package of a module named "contest".
+func IsStandardPath(goroot, importPath string) bool {
+	if goroot == "" {
+		goroot = build.Default.GOROOT
+	}
+	if importPath == "" || build.IsLocalImport(importPath) || filepath.IsAbs(importPath) {
+		return false
+	}
+	return isDir(filepath.Join(goroot, "src", filepath.FromSlash(importPath)))
+}
+
+// isStandard reports whether the importPath imported on the dir is of a
+// standard package of the target, whose resolution is cheap enough not to be
+// stored.  It includes the packages vendored in GOROOT/src/vendor imported
+// by standard packages.
+func (c *Cache) isStandard(importPath, dir string) bool {
+	if IsStandardPath(c.ctxt.GOROOT, importPath) {
+		return true
+	}
+	src := filepath.Join(c.ctxt.GOROOT, "src")
+	rel, err := filepath.Rel(src, dir)
+	if err != nil || !filepath.IsLocal(rel) {
+		return false
+	}
+	return isDir(filepath.Join(src, "vendor", filepath.FromSlash(importPath)))
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// forget removes the checked package for bp.  c.mu must be held.
+func (c *Cache) forget(bp *build.Package) {
+	if cp, ok := c.checked[bp]; ok {
+		delete(c.keys, cp.tp)
+		delete(c.checked, bp)
+	}
+}
+
+// load restores the package from the disk cache if possible, or type-checks it.
+// The result is stored to the disk cache if it is type-checked.  The
+// importKeys are the keys of the imports in the disk cache, or their paths
+// for standard packages.
+func (c *Cache) load(bp *build.Package, imp types.ImporterFrom, imports []*types.Package, importKeys []string) (*types.Package, []*ast.File, *types.Info, string, error) {
+	// standard packages are never stored because the ones checked from
+	// source don't have function bodies and the others are not checked.
+	// Cgo packages are not stored because their fake "C" package can't be
+	// encoded in export data.
+	if c.disk == nil || bp.Goroot || 0 < len(bp.CgoFiles) {
+		tp, files, info, err := c.typeCheck(bp, imp, imports)
+		return tp, files, info, "", err
+	}
+
+	key, err := c.disk.packageKey(bp, importKeys)
+	if err != nil {
+		tp, files, info, err := c.typeCheck(bp, imp, imports)
+		return tp, files, info, "", err
+	}
+	if e, ok := c.disk.getPackage(key); ok {
+		tp, files, info, err := c.restore(bp, imports, e)
+		if err == nil {
+			return tp, files, info, key, nil
+		}
+		// broken or stale entry; it is overwritten below
+	}
+
+	tp, files, info, err := c.typeCheck(bp, imp, imports)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+	if e, err := newPackageEntry(c.fset, tp, files, info); err == nil {
+		c.disk.putPackage(key, e) // the cache is best-effort
+	}
+	return tp, files, info, key, nil
+}
+
+// restore parses the files of bp and restores the type information from the entry e.
+func (c *Cache) restore(bp *build.Package, imports []*types.Package, e *packageEntry) (*types.Package, []*ast.File, *types.Info, error) {
+	files, err := parsePackage(c.fset, bp, c.files)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("parsing package: %w", err)
+	}
+
+	// Reading export data may complete the standard packages imported from
+	// export data.  Both of the importers reuse the objects in a package
+	// already declared by the other.
+	c.stdMu.Lock()
+	defer c.stdMu.Unlock()
+
+	pkgs := make(map[string]*types.Package)
+	var walk func(tps []*types.Package)
+	walk = func(tps []*types.Package) {
+		for _, tp := range tps {
+			if _, ok := pkgs[tp.Path()]; !ok {
+				pkgs[tp.Path()] = tp
+				walk(tp.Imports())
+			}
+		}
+	}
+	walk(imports)
+	for _, path := range e.Packages {
+		if tp, ok := pkgs[path]; ok && (tp.Complete() || c.std == nil) {
+			continue
+		}
+		if c.std == nil {
+			return nil, nil, nil, fmt.Errorf("package %q not loaded", path)
+		}
+		// import it completely not to let the export data of bp create
+		// another instance of the package or declare objects in it
+		tp, err := c.std.Import(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pkgs[path] = tp
+	}
+
+	tp, info, err := e.restore(c.fset, bp, files, pkgs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tp.SetImports(imports)
+	return tp, files, info, nil
+}
+
+func (c *Cache) typeCheck(bp *build.Package, imp types.ImporterFrom, imports []*types.Package) (*types.Package, []*ast.File, *types.Info, error) {
+	files, err := parsePackage(c.fset, bp, c.files)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("parsing package: %w", err)
+	}
+
+	var hardErrors, softErrors []error
+	tcfg := types.Config{
+		IgnoreFuncBodies: bp.Goroot && !c.inlined(bp), // doesn't check function body if the package is standard (in GOROOT/src)
+		GoVersion:        c.goVersion,
+		FakeImportC:      true,
+		Sizes:            types.SizesFor("gc", c.ctxt.GOARCH),
+		Error: func(err error) {
+			if terr, ok := err.(types.Error); ok && !terr.Soft {
+				hardErrors = append(hardErrors, err)
+			} else {
+				softErrors = append(softErrors, err)
+			}
+		},
+		Importer: imp,
+	}
+
+	if bp.Goroot && c.cfg.GOROOT == "" && !c.inlined(bp) {
+		// the local standard packages may use features of later versions,
+		// but the inlined ones must be built by the Go of the judge
+		tcfg.GoVersion = ""
+	}
+
+	info := newInfo()
+	tp, err := tcfg.Check(bp.ImportPath, c.fset, files, info)
+	if err != nil {
+		if 0 < len(hardErrors) {
+			return nil, nil, nil, fmt.Errorf("type checking: %w", c.sourceError(bp, hardErrors[0]))
+		} else {
+			return nil, nil, nil, fmt.Errorf("type checking: %w", c.sourceError(bp, err))
+		}
+	}
+	tp.SetImports(imports)
+
+	return tp, files, info, nil
+}
+
+// sourceError returns the given error of go/types as scanner.Error pointing at
+// the real file in bp.Dir instead of its pseudo file name
+func (c *Cache) sourceError(bp *build.Package, err error) error {
+	terr, ok := err.(types.Error)
+	if !ok {
+		return err
+	}
+	pos := c.fset.Position(terr.Pos)
+	if pos.Filename != "" {
+		pos.Filename = filepath.Join(bp.Dir, filepath.Base(pos.Filename))
+	}
+	return scanner.Error{Pos: pos, Msg: terr.Msg}
+}
+
+// importStd imports the standard package from its export data
+func (c *Cache) importStd(path string) (*types.Package, error) {
+	c.stdMu.Lock()
+	defer c.stdMu.Unlock()
+	return c.std.Import(path)
+}
+
+// prefetchStd finds export data for the given standard packages at once
+func (c *Cache) prefetchStd(paths []string) error {
+	c.stdMu.Lock()
+	defer c.stdMu.Unlock()
+	return c.std.prefetch(paths)
+}
+
+// stampPackage records the states of the directory and all files of the given bp.
+// Files in the overlay or the FS are skipped because they are never changed.
+func stampPackage(bp *build.Package, v *vfs) ([]fileStamp, error) {
+	names := []string{"."}
+	for _, fs := range [][]string{bp.GoFiles, bp.CgoFiles, bp.IgnoredGoFiles, bp.InvalidGoFiles, bp.CFiles, bp.HFiles, bp.SFiles} {
+		names = append(names, fs...)
+	}
+	res := make([]fileStamp, 0, len(names))
+	for _, name := range names {
+		path := filepath.Join(bp.Dir, name)
+		if v.immutable(path) {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			if name == "." && v.hasDir(path) {
+				continue
+			}
+			return nil, err
+		}
+		res = append(res, fileStamp{path: path, modTime: fi.ModTime(), size: fi.Size()})
+	}
+	return res, nil
+}
+
+// changed reports whether any of the files has been changed since the stamps were taken.
+func changed(stamps []fileStamp) bool {
+	for _, st := range stamps {
+		fi, err := os.Stat(st.path)
+		if err != nil || !fi.ModTime().Equal(st.modTime) || fi.Size() != st.size {
+			return true
+		}
+	}
+	return false
+}
+
+// newInfo creates an empty *types.Info recording all kinds of information
+func newInfo() *types.Info {
+	return &types.Info{
+		Types:        make(map[ast.Expr]types.TypeAndValue),
+		Instances:    make(map[*ast.Ident]types.Instance),
+		Defs:         make(map[*ast.Ident]types.Object),
+		Uses:         make(map[*ast.Ident]types.Object),
+		Implicits:    make(map[ast.Node]types.Object),
+		Selections:   make(map[*ast.SelectorExpr]*types.Selection),
+		Scopes:       make(map[ast.Node]*types.Scope),
+		FileVersions: make(map[*ast.File]string),
+	}
+}
+
+// mergeInfo copies the information in src to dst.  Only maps allocated in dst are copied.
+func mergeInfo(dst, src *types.Info) {
+	copyMap(dst.Types, src.Types)
+	copyMap(dst.Instances, src.Instances)
+	copyMap(dst.Defs, src.Defs)
+	copyMap(dst.Uses, src.Uses)
+	copyMap(dst.Implicits, src.Implicits)
+	copyMap(dst.Selections, src.Selections)
+	copyMap(dst.Scopes, src.Scopes)
+	copyMap(dst.FileVersions, src.FileVersions)
+}
+
+func copyMap[M ~map[K]V, K comparable, V any](dst, src M) {
+	if dst != nil {
+		maps.Copy(dst, src)
+	}
+}
@@ -0,0 +1,730 @@
+package pkginfo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/gcexportdata"
+	"golang.org/x/tools/go/types/objectpath"
+)
+
+// diskCacheVersion is changed whenever the format of the entries is changed
+const diskCacheVersion = "gottani-cache-2"
+
+// suffixes of the entry files in the cache directory
+const (
+	packageSuffix = "-p" // a type-checked package
+	dirSuffix     = "-d" // a resolved import path
+)
+
+// diskCache keeps type-checked packages in a directory to share them among
+// processes.  A package is stored as its export data, the objects denoted by
+// the identifiers in its files and the constant values of the conditions
+// deciding dead branches.  That is all what appinfo needs unless it prunes
+// methods or fields, so the package is restored by parsing its files without
+// type-checking.
+//
+// Entries are named by hashes of their contents (the files, the Go version,
+// the build config and the entries of the imported packages), so they are
+// never updated but only added.  Broken or stale entries are just ignored.
+type diskCache struct {
+	dir  string
+	salt []byte // hash of the Go version and the config, shared by all keys
+
+	files *vfs // the sources to be hashed
+}
+
+func newDiskCache(dir string, cfg *Config, ctxt *build.Context, files *vfs) *diskCache {
+	h := sha256.New()
+	fmt.Fprintln(h, diskCacheVersion)
+	fmt.Fprintln(h, runtime.Version())
+	fmt.Fprintln(h, ctxt.GOROOT)
+	if b, err := os.ReadFile(filepath.Join(ctxt.GOROOT, "VERSION")); err == nil {
+		h.Write(b)
+	}
+	fmt.Fprintln(h, ctxt.GOOS, ctxt.GOARCH, ctxt.CgoEnabled, strings.Join(ctxt.BuildTags, ","))
+	fmt.Fprintln(h, cfg.Modules, cfg.Vendor, cfg.StdExportData, cfg.goVersion())
+	return &diskCache{dir: dir, salt: h.Sum(nil), files: files}
+}
+
+// packageKey returns the key of the given bp.  The imports must be the keys
+// of the imported packages in the order of bp.Imports.
+func (dc *diskCache) packageKey(bp *build.Package, imports []string) (string, error) {
+	h := sha256.New()
+	h.Write(dc.salt)
+	fmt.Fprintln(h, bp.ImportPath, bp.Name)
+	for _, f := range append(bp.GoFiles[:len(bp.GoFiles):len(bp.GoFiles)], bp.CgoFiles...) {
+		b, err := dc.files.readFile(filepath.Join(bp.Dir, f))
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(b)
+		fmt.Fprintln(h, f, hex.EncodeToString(sum[:]))
+	}
+	for _, imp := range imports {
+		fmt.Fprintln(h, imp)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// dirKey returns the key of the resolution of the importPath on the dir.
+// It depends on the current directory and the go.mod, vendor/modules.txt and
+// go.work governing it.
+func (dc *diskCache) dirKey(importPath, dir string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(dc.salt)
+	fmt.Fprintln(h, cwd, importPath, dir)
+	for _, env := range []string{"GOPATH", "GO111MODULE", "GOFLAGS", "GOWORK"} {
+		fmt.Fprintln(h, os.Getenv(env))
+	}
+	for _, name := range []string{"go.mod", "go.work"} {
+		for d := cwd; ; d = filepath.Dir(d) {
+			if b, err := os.ReadFile(filepath.Join(d, name)); err == nil {
+				fmt.Fprintln(h, d)
+				h.Write(b)
+				if name == "go.mod" {
+					// the go command may use the vendor directory by default
+					b, _ := os.ReadFile(filepath.Join(d, "vendor", "modules.txt"))
+					h.Write(b)
+				}
+				break
+			}
+			if d == filepath.Dir(d) {
+				break
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (dc *diskCache) path(key, suffix string) string {
+	return filepath.Join(dc.dir, key[:2], key+suffix)
+}
+
+// getDir returns the abs path of the package stored with the key
+func (dc *diskCache) getDir(key string) (string, bool) {
+	b, err := os.ReadFile(dc.path(key, dirSuffix))
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// putDir stores the abs path of the package with the key
+func (dc *diskCache) putDir(key, abs string) error {
+	return dc.write(dc.path(key, dirSuffix), []byte(abs))
+}
+
+// getPackage returns the package stored with the key
+func (dc *diskCache) getPackage(key string) (*packageEntry, bool) {
+	b, err := os.ReadFile(dc.path(key, packageSuffix))
+	if err != nil {
+		return nil, false
+	}
+	var e packageEntry
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&e); err != nil {
+		return nil, false
+	}
+	return &e, true
+}
+
+// putPackage stores the package with the key
+func (dc *diskCache) putPackage(key string, e *packageEntry) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return err
+	}
+	return dc.write(dc.path(key, packageSuffix), buf.Bytes())
+}
+
+// write writes the file atomically so that concurrent readers never see a partial entry
+func (dc *diskCache) write(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// DiskCacheStats is statistics of a cache directory
+type DiskCacheStats struct {
+	Packages int   // number of type-checked packages
+	Dirs     int   // number of resolved import paths
+	Size     int64 // total size of the entries in bytes
+}
+
+// GetDiskCacheStats returns the statistics of the cache directory given as Config.CacheDir.
+func GetDiskCacheStats(dir string) (DiskCacheStats, error) {
+	var st DiskCacheStats
+	err := walkDiskCache(dir, func(path string, fi fs.FileInfo) error {
+		switch {
+		case strings.HasSuffix(path, packageSuffix):
+			st.Packages++
+		case strings.HasSuffix(path, dirSuffix):
+			st.Dirs++
+		}
+		st.Size += fi.Size()
+		return nil
+	})
+	return st, err
+}
+
+// CleanDiskCache removes all entries in the cache directory given as Config.CacheDir.
+// Files that are not created by the cache are left.
+func CleanDiskCache(dir string) error {
+	return walkDiskCache(dir, func(path string, _ fs.FileInfo) error {
+		err := os.Remove(path)
+		os.Remove(filepath.Dir(path)) // removed only if it gets empty
+		return err
+	})
+}
+
+// walkDiskCache calls fn for each entry in the cache directory
+func walkDiskCache(dir string, fn func(path string, fi fs.FileInfo) error) error {
+	subs, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if !sub.IsDir() || len(sub.Name()) != 2 {
+			continue
+		}
+		ents, err := os.ReadDir(filepath.Join(dir, sub.Name()))
+		if err != nil {
+			return err
+		}
+		for _, ent := range ents {
+			name := ent.Name()
+			if !strings.HasPrefix(name, sub.Name()) || !(strings.HasSuffix(name, packageSuffix) || strings.HasSuffix(name, dirSuffix)) {
+				continue
+			}
+			fi, err := ent.Info()
+			if err != nil {
+				return err
+			}
+			if err := fn(filepath.Join(dir, sub.Name(), name), fi); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// packageEntry is a type-checked package stored in the diskCache
+type packageEntry struct {
+	Export   []byte   // export data of the package
+	Packages []string // packages referred by Export
+
+	Objects   []objectFact
+	Idents    []identFact
+	Implicits []implicitFact
+	Consts    []constFact
+}
+
+// kinds of objectFact
+const (
+	objNil      = iota // nil object, e.g. Defs of the package name
+	objUniverse        // object in types.Universe
+	objScope           // package-level object
+	objMember          // method or field declared directly in a package-level type
+	objPath            // other object addressable by objectpath
+	objPkgName         // *types.PkgName declared by an import
+	objLocal           // other objects only identity and kind of them matter
+)
+
+// objectFact describes an object denoted by identifiers
+type objectFact struct {
+	Kind int
+	Pkg  string // package of the object or the imported one for objPkgName
+	Type string // package-level type declaring the objMember
+	Path objectpath.Path
+	Name string
+	File int // index of the file declaring the objLocal or -1
+	Off  int // offset of the objLocal in the File
+
+	// Local is "var" or "field" if the objLocal is a variable or a field,
+	// which appinfo tells from the others to find variables left unused
+	Local string
+}
+
+// identFact records the object denoted by the identifier.
+// Selections are also recorded as uses of their Sel.
+type identFact struct {
+	File int
+	Off  int
+	Def  bool
+	Obj  int // index of Objects
+}
+
+// implicitFact records the object implicitly declared by the node
+type implicitFact struct {
+	File int
+	Off  int
+	Node string // type of the node
+	Obj  int    // index of Objects
+}
+
+// constFact records the constant value of a condition, see conditions()
+type constFact struct {
+	File  int
+	Off   int
+	Kind  constant.Kind
+	Value string // constant.Value.ExactString()
+}
+
+// conditions calls fn for each condition of the if and switch statements in
+// the file: the conditions of if statements, the tags of switch statements
+// and the expressions of their case clauses.
+func conditions(f *ast.File, fn func(expr ast.Expr)) {
+	ast.Inspect(f, func(nd ast.Node) bool {
+		switch nd := nd.(type) {
+		case *ast.IfStmt:
+			fn(nd.Cond)
+		case *ast.SwitchStmt:
+			if nd.Tag != nil {
+				fn(nd.Tag)
+			}
+			for _, s := range nd.Body.List {
+				for _, expr := range s.(*ast.CaseClause).List {
+					fn(expr)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// makeConst returns the constant value recorded as the constFact, or nil if
+// it is broken
+func makeConst(cf constFact) constant.Value {
+	switch cf.Kind {
+	case constant.Bool:
+		return constant.MakeBool(cf.Value == "true")
+	case constant.String:
+		s, err := strconv.Unquote(cf.Value)
+		if err != nil {
+			return nil
+		}
+		return constant.MakeString(s)
+	case constant.Int, constant.Float:
+		// exact floats are written as fractions
+		num, den, ok := strings.Cut(cf.Value, "/")
+		x := constant.MakeFromLiteral(num, token.FLOAT, 0)
+		if !ok {
+			x = constant.ToInt(x)
+			if cf.Kind == constant.Float {
+				x = constant.ToFloat(x)
+			}
+			return x
+		}
+		y := constant.MakeFromLiteral(den, token.FLOAT, 0)
+		if x.Kind() == constant.Unknown || y.Kind() == constant.Unknown || constant.Sign(y) == 0 {
+			return nil
+		}
+		return constant.BinaryOp(x, token.QUO, y)
+	}
+	return nil
+}
+
+// newPackageEntry creates packageEntry for the package checked from source
+func newPackageEntry(fset *token.FileSet, tp *types.Package, files []*ast.File, info *types.Info) (*packageEntry, error) {
+	e := &packageEntry{}
+	var buf bytes.Buffer
+	if err := gcexportdata.Write(&buf, fset, tp); err != nil {
+		return nil, err
+	}
+	e.Export = buf.Bytes()
+
+	// read it back to know the referred packages
+	rp, err := gcexportdata.Read(bytes.NewReader(e.Export), token.NewFileSet(), make(map[string]*types.Package), tp.Path())
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range rp.Imports() {
+		e.Packages = append(e.Packages, p.Path())
+	}
+
+	tfiles := make(map[*token.File]int)
+	for i, f := range files {
+		tfiles[fset.File(f.Pos())] = i
+	}
+	position := func(pos token.Pos) (int, int) {
+		tf := fset.File(pos)
+		i, ok := tfiles[tf]
+		if !ok {
+			return -1, 0
+		}
+		return i, tf.Offset(pos)
+	}
+
+	enc := new(objectpath.Encoder)
+	owners := make(map[*types.Package]map[types.Object]string)
+	objs := make(map[types.Object]int)
+	object := func(obj types.Object) int {
+		if i, ok := objs[obj]; ok {
+			return i
+		}
+		// objects are objLocal unless they can be found in other ways
+		of := objectFact{Kind: objLocal, File: -1}
+		switch obj := obj.(type) {
+		case nil:
+			of.Kind = objNil
+		case *types.PkgName:
+			of.Kind = objPkgName
+			of.Pkg = obj.Imported().Path()
+			of.Name = obj.Name()
+		default:
+			of.Name = obj.Name()
+			pkg := obj.Pkg()
+			// rp is the package as other packages see it.  Objects missing
+			// in it are never referred from other packages.
+			lookup := pkg
+			if pkg == tp {
+				lookup = rp
+			}
+			if pkg == nil {
+				if types.Universe.Lookup(obj.Name()) == obj {
+					of.Kind = objUniverse
+				}
+			} else if obj.Parent() == pkg.Scope() {
+				if pkg.Scope().Lookup(obj.Name()) == obj && lookup.Scope().Lookup(obj.Name()) != nil {
+					of.Kind = objScope
+					of.Pkg = pkg.Path()
+				}
+			} else if obj.Parent() != nil {
+				// declared in a function
+			} else if typ := memberOwner(owners, obj); typ != "" {
+				// instantiated methods and fields are not members of the type,
+				// but of the instance
+				if lookupMember(pkg, typ, obj.Name()) == obj && lookupMember(lookup, typ, obj.Name()) != nil {
+					of.Kind = objMember
+					of.Pkg = pkg.Path()
+					of.Type = typ
+				}
+			} else if pkg != tp || token.IsExported(obj.Name()) {
+				// objectpath is slow; it searches all objects in the package
+				if path, err := enc.For(obj); err == nil && inExport(lookup, path) {
+					of.Kind = objPath
+					of.Pkg = pkg.Path()
+					of.Path = path
+				}
+			}
+			if of.Kind == objLocal {
+				of.File, of.Off = position(obj.Pos())
+				if v, ok := obj.(*types.Var); ok {
+					of.Local = "var"
+					if v.IsField() {
+						of.Local = "field"
+					}
+				}
+			}
+		}
+		objs[obj] = len(e.Objects)
+		e.Objects = append(e.Objects, of)
+		return objs[obj]
+	}
+
+	ident := func(id *ast.Ident, obj types.Object, def bool) error {
+		file, off := position(id.Pos())
+		if file < 0 {
+			return fmt.Errorf("%s: identifier out of the package", fset.Position(id.Pos()))
+		}
+		e.Idents = append(e.Idents, identFact{File: file, Off: off, Def: def, Obj: object(obj)})
+		return nil
+	}
+	for id, obj := range info.Defs {
+		if err := ident(id, obj, true); err != nil {
+			return nil, err
+		}
+	}
+	for id, obj := range info.Uses {
+		if err := ident(id, obj, false); err != nil {
+			return nil, err
+		}
+	}
+	for expr, sel := range info.Selections {
+		if err := ident(expr.Sel, sel.Obj(), false); err != nil {
+			return nil, err
+		}
+	}
+	for nd, obj := range info.Implicits {
+		file, off := position(nd.Pos())
+		if file < 0 {
+			return nil, fmt.Errorf("%s: node out of the package", fset.Position(nd.Pos()))
+		}
+		e.Implicits = append(e.Implicits, implicitFact{File: file, Off: off, Node: fmt.Sprintf("%T", nd), Obj: object(obj)})
+	}
+	for _, f := range files {
+		conditions(f, func(expr ast.Expr) {
+			tv := info.Types[expr]
+			if tv.Value == nil {
+				return
+			}
+			switch tv.Value.Kind() {
+			case constant.Bool, constant.String, constant.Int, constant.Float:
+				file, off := position(expr.Pos())
+				e.Consts = append(e.Consts, constFact{File: file, Off: off, Kind: tv.Value.Kind(), Value: tv.Value.ExactString()})
+			}
+		})
+	}
+	return e, nil
+}
+
+// memberOwner returns the name of the package-level type declaring the
+// method or field obj, or "" if it is not such an object.  The owners memoize
+// fields of the types for each package.
+func memberOwner(owners map[*types.Package]map[types.Object]string, obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Func:
+		recv := obj.Signature().Recv()
+		if recv == nil {
+			return ""
+		}
+		typ := recv.Type()
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		if named, ok := typ.(*types.Named); ok && named.Obj().Parent() == obj.Pkg().Scope() {
+			return named.Obj().Name()
+		}
+	case *types.Var:
+		if !obj.IsField() {
+			return ""
+		}
+		m, ok := owners[obj.Pkg()]
+		if !ok {
+			m = make(map[types.Object]string)
+			scope := obj.Pkg().Scope()
+			for _, name := range scope.Names() {
+				if st, ok := scope.Lookup(name).Type().Underlying().(*types.Struct); ok {
+					for i := 0; i < st.NumFields(); i++ {
+						m[st.Field(i)] = name
+					}
+				}
+			}
+			owners[obj.Pkg()] = m
+		}
+		return m[obj]
+	}
+	return ""
+}
+
+// lookupMember finds the method or field declared directly in the package-level type
+func lookupMember(pkg *types.Package, typ, name string) types.Object {
+	tn, ok := pkg.Scope().Lookup(typ).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	if named, ok := tn.Type().(*types.Named); ok {
+		for i := 0; i < named.NumMethods(); i++ {
+			if m := named.Method(i); m.Name() == name {
+				return m
+			}
+		}
+	}
+	switch u := tn.Type().Underlying().(type) {
+	case *types.Interface:
+		for i := 0; i < u.NumExplicitMethods(); i++ {
+			if m := u.ExplicitMethod(i); m.Name() == name {
+				return m
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if f := u.Field(i); f.Name() == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// inExport reports whether the object at the path is in the package read
+// from export data.  Unexported objects not reachable from exported ones are
+// not in export data but they are never referred from other packages.
+func inExport(tp *types.Package, path objectpath.Path) bool {
+	_, err := objectpath.Object(tp, path)
+	return err == nil
+}
+
+// restore restores the types.Package and the types.Info of the package
+// whose files are parsed again.  The pkgs must have all packages referred by
+// the export data.  Only Defs, Uses and Implicits of the result are filled,
+// and Types only with the values of the constant conditions.
+func (e *packageEntry) restore(fset *token.FileSet, bp *build.Package, files []*ast.File, pkgs map[string]*types.Package) (*types.Package, *types.Info, error) {
+	tp, err := gcexportdata.Read(bytes.NewReader(e.Export), fset, pkgs, bp.ImportPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading export data: %w", err)
+	}
+
+	tfiles := make([]*token.File, len(files))
+	idents := make([]map[int]*ast.Ident, len(files))
+	nodes := make([]map[string]ast.Node, len(files))
+	conds := make([]map[int]ast.Expr, len(files))
+	for i, f := range files {
+		tf := fset.File(f.Pos())
+		tfiles[i] = tf
+		idents[i] = make(map[int]*ast.Ident)
+		nodes[i] = make(map[string]ast.Node)
+		conds[i] = make(map[int]ast.Expr)
+		ast.Inspect(f, func(nd ast.Node) bool {
+			switch nd := nd.(type) {
+			case *ast.Ident:
+				idents[i][tf.Offset(nd.Pos())] = nd
+			case *ast.ImportSpec, *ast.CaseClause, *ast.Field:
+				nodes[i][fmt.Sprintf("%T@%d", nd, tf.Offset(nd.Pos()))] = nd
+			}
+			return true
+		})
+		conditions(f, func(expr ast.Expr) {
+			conds[i][tf.Offset(expr.Pos())] = expr
+		})
+	}
+	position := func(file, off int) (token.Pos, error) {
+		if file < 0 {
+			return token.NoPos, nil
+		}
+		if len(files) <= file || tfiles[file].Size() < off {
+			return token.NoPos, fmt.Errorf("position out of range: file %d, offset %d", file, off)
+		}
+		return tfiles[file].Pos(off), nil
+	}
+
+	objs := make([]types.Object, len(e.Objects))
+	for i, of := range e.Objects {
+		var obj types.Object
+		switch of.Kind {
+		case objNil:
+		case objUniverse:
+			obj = types.Universe.Lookup(of.Name)
+		case objScope, objMember, objPath:
+			p := tp
+			if of.Pkg != tp.Path() {
+				p = pkgs[of.Pkg]
+			}
+			if p == nil {
+				return nil, nil, fmt.Errorf("package %q of %s not found", of.Pkg, of.Name)
+			}
+			switch of.Kind {
+			case objScope:
+				obj = p.Scope().Lookup(of.Name)
+			case objMember:
+				obj = lookupMember(p, of.Type, of.Name)
+			case objPath:
+				obj, err = objectpath.Object(p, of.Path)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+		case objPkgName:
+			imported := pkgs[of.Pkg]
+			if of.Pkg == "unsafe" {
+				imported = types.Unsafe
+			}
+			if imported == nil {
+				return nil, nil, fmt.Errorf("imported package %q not found", of.Pkg)
+			}
+			obj = types.NewPkgName(token.NoPos, tp, of.Name, imported)
+		case objLocal:
+			pos, err := position(of.File, of.Off)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch of.Local {
+			case "var":
+				obj = types.NewVar(pos, tp, of.Name, nil)
+			case "field":
+				obj = types.NewField(pos, tp, of.Name, nil, false)
+			default:
+				// any object other than variables will do
+				obj = types.NewLabel(pos, tp, of.Name)
+			}
+		default:
+			return nil, nil, fmt.Errorf("unknown kind of object: %d", of.Kind)
+		}
+		if of.Kind != objNil && (obj == nil || obj.Name() != of.Name) {
+			return nil, nil, fmt.Errorf("object %q not found", of.Name)
+		}
+		objs[i] = obj
+	}
+
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	for _, idf := range e.Idents {
+		if idf.File < 0 || len(files) <= idf.File || idf.Obj < 0 || len(objs) <= idf.Obj {
+			return nil, nil, errors.New("broken identifier")
+		}
+		id, ok := idents[idf.File][idf.Off]
+		if !ok {
+			return nil, nil, fmt.Errorf("identifier not found: file %d, offset %d", idf.File, idf.Off)
+		}
+		if idf.Def {
+			info.Defs[id] = objs[idf.Obj]
+		} else {
+			info.Uses[id] = objs[idf.Obj]
+		}
+	}
+	for _, imf := range e.Implicits {
+		if imf.File < 0 || len(files) <= imf.File || imf.Obj < 0 || len(objs) <= imf.Obj {
+			return nil, nil, errors.New("broken implicit")
+		}
+		nd, ok := nodes[imf.File][fmt.Sprintf("%s@%d", imf.Node, imf.Off)]
+		if !ok {
+			return nil, nil, fmt.Errorf("node not found: file %d, offset %d", imf.File, imf.Off)
+		}
+		info.Implicits[nd] = objs[imf.Obj]
+	}
+	for _, cf := range e.Consts {
+		if cf.File < 0 || len(files) <= cf.File {
+			return nil, nil, errors.New("broken constant")
+		}
+		expr, ok := conds[cf.File][cf.Off]
+		if !ok {
+			return nil, nil, fmt.Errorf("condition not found: file %d, offset %d", cf.File, cf.Off)
+		}
+		v := makeConst(cf)
+		if v == nil {
+			return nil, nil, fmt.Errorf("broken constant: %q", cf.Value)
+		}
+		info.Types[expr] = types.TypeAndValue{Value: v}
+	}
+	return tp, info, nil
+}
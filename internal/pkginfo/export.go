@@ -0,0 +1,105 @@
+package pkginfo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// exportImporter imports standard packages from the export data compiled by
+// the go command instead of parsing and type-checking their source.
+// The export data is kept in the build cache so it is compiled only once.
+type exportImporter struct {
+	ctxt *build.Context
+
+	// files keeps mapping from import path to its export data file
+	files map[string]string
+
+	imp types.Importer
+}
+
+func newExportImporter(ctxt *build.Context, fset *token.FileSet) *exportImporter {
+	ei := &exportImporter{
+		ctxt:  ctxt,
+		files: make(map[string]string),
+	}
+	ei.imp = importer.ForCompiler(fset, "gc", ei.lookup)
+	return ei
+}
+
+// Import imports the standard package specified by the path
+func (ei *exportImporter) Import(path string) (*types.Package, error) {
+	if err := ei.prefetch([]string{path}); err != nil {
+		return nil, err
+	}
+	return ei.imp.Import(path)
+}
+
+// prefetch finds export data files for the given paths and their dependencies at once.
+func (ei *exportImporter) prefetch(paths []string) error {
+	var missing []string
+	for _, path := range paths {
+		if _, ok := ei.files[path]; !ok && path != "unsafe" {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	cgo := "0"
+	if ei.ctxt.CgoEnabled {
+		cgo = "1"
+	}
+	args := []string{
+		"list", "-export", "-deps",
+		"-tags=" + strings.Join(ei.ctxt.BuildTags, ","),
+		"-f", "{{if .Export}}{{.ImportPath}}\t{{.Export}}{{end}}",
+		"--",
+	}
+	cmd := exec.Command(filepath.Join(ei.ctxt.GOROOT, "bin", "go"), append(args, missing...)...)
+	// Run it in GOROOT/src so that the go.mod of the application doesn't matter
+	cmd.Dir = filepath.Join(ei.ctxt.GOROOT, "src")
+	cmd.Env = append(os.Environ(),
+		"GOOS="+ei.ctxt.GOOS,
+		"GOARCH="+ei.ctxt.GOARCH,
+		"GOROOT="+ei.ctxt.GOROOT,
+		"CGO_ENABLED="+cgo,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go list -export %s: %w\n%s", strings.Join(missing, " "), err, stderr.String())
+	}
+
+	sc := bufio.NewScanner(&stdout)
+	for sc.Scan() {
+		path, file, ok := strings.Cut(sc.Text(), "\t")
+		if !ok {
+			continue
+		}
+		ei.files[path] = file
+	}
+	return sc.Err()
+}
+
+func (ei *exportImporter) lookup(path string) (io.ReadCloser, error) {
+	if err := ei.prefetch([]string{path}); err != nil {
+		return nil, err
+	}
+	file, ok := ei.files[path]
+	if !ok {
+		return nil, fmt.Errorf("no export data for %q", path)
+	}
+	return os.Open(file)
+}
@@ -0,0 +1,143 @@
+package pkginfo
+
+import (
+	"errors"
+	"fmt"
+	"go/build"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// loadModules resolves the whole import graph of the given root package
+// through the go command and registers the result to the cache of
+// getBuildPackage() so that it never falls back on go/build.
+//
+// The files of each package are still selected by go/build so that both
+// loaders see the same set of files.
+func (ip *PackageInfo) loadModules(root *build.Package, patterns []string) error {
+	cgo := "0"
+	if ip.cache.ctxt.CgoEnabled {
+		cgo = "1"
+	}
+	pcfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps,
+		Dir:  root.Dir,
+		Env: append(os.Environ(),
+			"GOOS="+ip.cache.ctxt.GOOS,
+			"GOARCH="+ip.cache.ctxt.GOARCH,
+			"CGO_ENABLED="+cgo,
+		),
+		BuildFlags: []string{"-tags=" + strings.Join(ip.cache.ctxt.BuildTags, ",")},
+	}
+	if ip.cache.files != nil {
+		pcfg.Overlay = ip.cache.files.overlay
+	}
+	if ip.cache.cfg.Vendor {
+		pcfg.BuildFlags = append(pcfg.BuildFlags, "-mod=vendor")
+	}
+	roots, err := packages.Load(pcfg, patterns...)
+	if err != nil {
+		return fmt.Errorf("listing packages on %q: %w", root.Dir, err)
+	}
+	if len(roots) != 1 {
+		return fmt.Errorf("listing packages on %q: %d packages found", root.Dir, len(roots))
+	}
+
+	var errs []error
+	packages.Visit(roots, nil, func(p *packages.Package) {
+		for _, err := range p.Errors {
+			errs = append(errs, err)
+		}
+	})
+	if 0 < len(errs) {
+		return errors.Join(errs...)
+	}
+
+	bps := map[*packages.Package]*build.Package{roots[0]: root}
+	if err := ip.registerModules(roots, bps); err != nil {
+		return err
+	}
+	return ip.loadReplacements(pcfg)
+}
+
+// loadReplacements loads the replacements in Config.Replace and registers
+// them with the empty dir, so that getBuildPackage() finds them from any
+// package.  Replacements which fail to load are ignored here and reported
+// when they are imported.
+func (ip *PackageInfo) loadReplacements(pcfg *packages.Config) error {
+	if len(ip.cache.cfg.Replace) == 0 {
+		return nil
+	}
+	var paths []string
+	for _, path := range ip.cache.cfg.Replace {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	roots, err := packages.Load(pcfg, paths...)
+	if err != nil {
+		return fmt.Errorf("listing replacements: %w", err)
+	}
+	for _, r := range roots {
+		ok := true
+		packages.Visit([]*packages.Package{r}, nil, func(p *packages.Package) {
+			ok = ok && len(p.Errors) == 0
+		})
+		if !ok {
+			continue
+		}
+		bps := make(map[*packages.Package]*build.Package)
+		if err := ip.registerModules([]*packages.Package{r}, bps); err != nil {
+			return err
+		}
+		ip.pkgs[pkgKey{r.PkgPath, ""}] = bps[r]
+	}
+	return nil
+}
+
+// registerModules imports the packages listed by the go command and
+// registers them to the cache of getBuildPackage().  The bps maps the
+// packages already imported.
+func (ip *PackageInfo) registerModules(roots []*packages.Package, bps map[*packages.Package]*build.Package) error {
+	var visitErr error
+	packages.Visit(roots, nil, func(p *packages.Package) {
+		if visitErr != nil {
+			return
+		}
+		if _, ok := bps[p]; ok {
+			return
+		}
+		if ip.cache.cfg.GOROOT != "" && ip.cache.isStandard(p.PkgPath, p.Dir) {
+			// listed by the local go command; resolved in the GOROOT later
+			return
+		}
+		bp, err := ip.cache.importDir(p.PkgPath, p.Dir)
+		if err != nil {
+			visitErr = fmt.Errorf("importing %q: %w", p.PkgPath, err)
+			return
+		}
+		bps[p] = bp
+		ip.pkgs[pkgKey{".", p.Dir}] = bp
+	})
+	if visitErr != nil {
+		return visitErr
+	}
+
+	// register the imports with the importer's pseudo dir, that is the dir
+	// of the file names in the fset and passed to ImportFrom() by go/types
+	for p, bp := range bps {
+		for ipath, dep := range p.Imports {
+			if bps[dep] == nil {
+				continue
+			}
+			ip.pkgs[pkgKey{ipath, bp.ImportPath}] = bps[dep]
+			if bp.Name == "main" {
+				ip.pkgs[pkgKey{ipath, "."}] = bps[dep]
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package pkginfo
+
+import (
+	"fmt"
+	"go/build"
+	"go/types"
+	"runtime"
+)
+
+// loadParallel loads the package specified by the given bp and the packages
+// it imports like load(), but parses and type-checks packages in parallel
+// along the import graph.  The results are recorded in the same order as
+// load() so that they are the same.
+func (ip *PackageInfo) loadParallel(root *build.Package) error {
+	// resolve the whole import graph first because getBuildPackage() is not
+	// safe for concurrent use
+	var order []*build.Package // packages to be checked in post-order
+	deps := make(map[*build.Package][]*build.Package)
+	var visit func(bp *build.Package) error
+	visit = func(bp *build.Package) error {
+		if _, ok := deps[bp]; ok {
+			return nil
+		}
+		if _, ok := ip.typesPkgs[bp]; ok {
+			return nil
+		}
+		if bp.Goroot && bp.ImportPath == "unsafe" {
+			ip.typesPkgs[bp] = types.Unsafe
+			return nil
+		}
+		if ip.cache.std != nil && bp.Goroot && bp != fakeCbpkg {
+			// standard packages are imported before checking to keep them
+			// unchanged while other packages are checked
+			tp, err := ip.cache.importStd(bp.ImportPath)
+			if err != nil {
+				return fmt.Errorf("importing export data of %q: %w", bp.ImportPath, err)
+			}
+			ip.typesPkgs[bp] = tp
+			return nil
+		}
+
+		ip.addSrcDir(bp)
+		var ibps []*build.Package
+		for _, ipath := range bp.Imports {
+			ibp, err := ip.getBuildPackage(ipath, bp.ImportPath)
+			if err != nil {
+				return fmt.Errorf("getting *build.Package for %q on %q: %w", ipath, bp.ImportPath, err)
+			}
+			ibps = append(ibps, ibp)
+		}
+		deps[bp] = ibps
+
+		if ip.cache.std != nil {
+			var stdPaths []string
+			for _, ibp := range ibps {
+				if ibp.Goroot && ibp != fakeCbpkg {
+					stdPaths = append(stdPaths, ibp.ImportPath)
+				}
+			}
+			if err := ip.cache.prefetchStd(stdPaths); err != nil {
+				return fmt.Errorf("finding export data: %w", err)
+			}
+		}
+
+		for _, ibp := range ibps {
+			if ibp == fakeCbpkg {
+				continue
+			}
+			if err := visit(ibp); err != nil {
+				return fmt.Errorf("loading %q: %w", ibp.ImportPath, err)
+			}
+		}
+		order = append(order, bp)
+		return nil
+	}
+	if err := visit(root); err != nil {
+		return err
+	}
+
+	// check each package after the packages it imports.  The results map
+	// is not modified while the goroutines are running.
+	type result struct {
+		done chan struct{}
+		cp   *checkedPackage
+		err  error
+	}
+	results := make(map[*build.Package]*result)
+	for _, bp := range order {
+		results[bp] = &result{done: make(chan struct{})}
+	}
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for _, bp := range order {
+		go func(bp *build.Package, res *result) {
+			defer close(res.done)
+
+			imps := importMap{}
+			var tps []*types.Package
+			for i, ibp := range deps[bp] {
+				if ibp == fakeCbpkg {
+					continue
+				}
+				tp, ok := ip.typesPkgs[ibp]
+				if !ok {
+					dep := results[ibp]
+					<-dep.done
+					if dep.err != nil {
+						res.err = fmt.Errorf("loading %q: %w", ibp.ImportPath, dep.err)
+						return
+					}
+					tp = dep.cp.tp
+				}
+				imps[bp.Imports[i]] = tp
+				tps = append(tps, tp)
+			}
+
+			sem <- struct{}{}
+			res.cp, res.err = ip.cache.check(bp, imps, tps)
+			<-sem
+		}(bp, results[bp])
+	}
+	if res := results[root]; res != nil {
+		<-res.done
+		if res.err != nil {
+			return res.err
+		}
+	}
+
+	for _, bp := range order {
+		res := results[bp]
+		<-res.done
+		ip.imports[bp] = deps[bp]
+		ip.astFiles[bp] = res.cp.files
+		ip.typesPkgs[bp] = res.cp.tp
+		mergeInfo(ip.tinfo, res.cp.info)
+	}
+	return nil
+}
+
+// importMap is types.ImporterFrom for a package whose imports are all loaded.
+// It maps the import paths in the package to the loaded packages.
+type importMap map[string]*types.Package
+
+func (m importMap) Import(path string) (*types.Package, error) {
+	return m.ImportFrom(path, ".", 0)
+}
+
+func (m importMap) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	tp, ok := m[path]
+	if !ok {
+		return nil, fmt.Errorf("package %q is not imported on %q", path, dir)
+	}
+	return tp, nil
+}
@@ -9,8 +9,14 @@ import (
 	"go/parser"
 	"go/token"
 	"go/types"
-	"io/ioutil"
+	"go/version"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // fakeCbpkg is *build.Pacakge for `import "C"`
@@ -31,12 +37,162 @@ type pkgKey struct {
 	dir        string
 }
 
+// Config is a configuration for loading packages.
+type Config struct {
+	// Modules makes PackageInfo resolve the whole import graph through the go
+	// command (golang.org/x/tools/go/packages) at once instead of resolving
+	// imports one by one with go/build.  It understands go.work workspaces,
+	// replace directives and the module cache as `go build` does.
+	Modules bool
+
+	// GOOS and GOARCH are the target of the application.  The host's ones
+	// are used if they are empty.
+	GOOS   string
+	GOARCH string
+
+	// BuildTags are additional build tags to select files.
+	BuildTags []string
+
+	// CgoEnabled is the same as CGO_ENABLED.  If it is nil, it follows the
+	// go command: the environment variable or the default of the target.
+	CgoEnabled *bool
+
+	// StdExportData makes PackageInfo import standard packages from the
+	// export data compiled by the go command instead of parsing and
+	// type-checking their source.  Only non-standard packages have
+	// *ast.File and entries in types.Info then.
+	StdExportData bool
+
+	// Overlay maps paths of files to their contents which are used instead
+	// of the files on the disk like packages.Config.Overlay, e.g. unsaved
+	// buffers of an editor.  Files only in Overlay are also added to their
+	// packages.  The file names in the combined source are still the real
+	// ones.
+	Overlay map[string][]byte
+
+	// FS is the file system which the root and library packages are read
+	// from instead of the disk, e.g. an archive or fstest.MapFS.  Imports
+	// are resolved by the go.mod files in it, or as GOPATH/src for paths
+	// not in any of the modules.  Standard packages are still read from
+	// GOROOT.  Paths given to Load and in Overlay are relative to its root.
+	// Modules and Vendor are not supported with it.
+	FS fs.FS
+
+	// Vendor makes imports resolved from the vendor directory of the main
+	// module like `go build -mod=vendor`.  The main module is the one
+	// containing the current directory.
+	Vendor bool
+
+	// GOROOT is the root of another Go tree whose standard packages are
+	// used instead of the local ones, e.g. a checkout of the judge's
+	// version.  Standard packages are always checked from their source then
+	// and StdExportData is ignored.
+	GOROOT string
+
+	// GoVersion is the Go version of the judge such as "go1.20".  Language
+	// features and files for later versions are rejected.  It is the
+	// version in GOROOT/VERSION if it is empty and GOROOT is given.
+	// Standard packages are checked against it only if GOROOT is given.
+	GoVersion string
+
+	// CacheDir is a directory to keep type-checked packages and resolved
+	// imports across processes.  Packages restored from it are not
+	// type-checked again, so only Defs, Uses and Implicits of types.Info are
+	// filled for them and selections are recorded as Uses.  The cache is
+	// disabled if it is empty.
+	CacheDir string
+
+	// Parallel makes PackageInfo parse and type-check packages in parallel
+	// along the import graph.  The results are the same as the sequential
+	// loading.
+	Parallel bool
+
+	// Keep are the import path patterns of non-standard packages which are
+	// kept as imports like standard ones instead of being combined, e.g.
+	// packages provided by the judge.  See MatchPatterns for the patterns.
+	// They are still loaded for type-checking.
+	Keep []string
+
+	// Inline are the import path patterns of standard packages which are
+	// combined like non-standard ones, e.g. ones missing in the judge's
+	// version.  They are type-checked with their function bodies.
+	// StdExportData is ignored if it is given.
+	Inline []string
+
+	// Replace maps import paths to the ones of the packages used instead,
+	// e.g. a variant of a library for the judge.  The API of a replacement
+	// must have all the exported identifiers of the replaced package with
+	// the same types.  Imports in the replacement itself aren't replaced.
+	Replace map[string]string
+}
+
+// buildContext creates build.Context for the target described by the cfg
+func (cfg *Config) buildContext() *build.Context {
+	ctxt := build.Default
+	if cfg.GOOS != "" {
+		ctxt.GOOS = cfg.GOOS
+	}
+	if cfg.GOARCH != "" {
+		ctxt.GOARCH = cfg.GOARCH
+	}
+	if cfg.CgoEnabled != nil {
+		ctxt.CgoEnabled = *cfg.CgoEnabled
+	} else if os.Getenv("CGO_ENABLED") == "" && (ctxt.GOOS != runtime.GOOS || ctxt.GOARCH != runtime.GOARCH) {
+		// the go command disables cgo by default on cross compiling
+		ctxt.CgoEnabled = false
+	}
+	ctxt.BuildTags = append(ctxt.BuildTags[:len(ctxt.BuildTags):len(ctxt.BuildTags)], cfg.BuildTags...)
+	if cfg.GOROOT != "" {
+		ctxt.GOROOT = cfg.GOROOT
+	}
+	if tags := releaseTags(cfg.goVersion()); tags != nil {
+		ctxt.ReleaseTags = tags
+	}
+	return &ctxt
+}
+
+// goVersion returns the Go version of the target or "" if it is not given
+func (cfg *Config) goVersion() string {
+	if cfg.GoVersion != "" || cfg.GOROOT == "" {
+		return cfg.GoVersion
+	}
+	b, err := os.ReadFile(filepath.Join(cfg.GOROOT, "VERSION"))
+	if err != nil {
+		return ""
+	}
+	v, _, _ := strings.Cut(string(b), "\n")
+	if !version.IsValid(v) {
+		return ""
+	}
+	return v
+}
+
+// releaseTags returns the release tags satisfied by the given version, i.e.
+// go1.1 to go1.N for go1.N.x.  It returns nil if the v is not valid.
+func releaseTags(v string) []string {
+	minor, err := strconv.Atoi(strings.TrimPrefix(version.Lang(v), "go1."))
+	if err != nil {
+		return nil
+	}
+	var tags []string
+	for i := 1; i <= minor; i++ {
+		tags = append(tags, fmt.Sprintf("go1.%d", i))
+	}
+	return tags
+}
+
 // PackageInfo represents information of packages used by a applicaion for gottani.
 // It also implements types.Importer for parsing and type-checking.
 type PackageInfo struct {
+	// cache keeps packages possibly shared with other PackageInfos
+	cache *Cache
+
 	// mapping (dir, importPath) => *build.Packages
 	pkgs map[pkgKey]*build.Package
 
+	// imports keeps mapping from *build.Package to the packages it imports
+	imports map[*build.Package][]*build.Package
+
 	// typesPkgs keeps mapping from *build.Package to *types.Package
 	typesPkgs map[*build.Package]*types.Package
 
@@ -48,6 +204,13 @@ type PackageInfo struct {
 
 	rootPackage *build.Package
 
+	// replaced keeps the import paths whose replacement has been checked
+	replaced map[string]bool
+
+	// srcDirs maps the dirs passed to getBuildPackage(), the import paths of
+	// the importers or "." for main packages, to their real dirs
+	srcDirs map[string]string
+
 	// memo for Pacakges() and AllPackages()
 	pkgSlice    []*build.Package
 	allPkgSlice []*build.Package
@@ -55,27 +218,43 @@ type PackageInfo struct {
 
 // New creates PackageInfo with default setting and then Load the given dir
 func New(dir string) (*PackageInfo, error) {
-	fset := token.NewFileSet()
-	tinfo := &types.Info{
-		Types:      make(map[ast.Expr]types.TypeAndValue),
-		Defs:       make(map[*ast.Ident]types.Object),
-		Uses:       make(map[*ast.Ident]types.Object),
-		Implicits:  make(map[ast.Node]types.Object),
-		Selections: make(map[*ast.SelectorExpr]*types.Selection),
-		Scopes:     make(map[ast.Node]*types.Scope),
-	}
-	pi := NewPackageInfo(fset, tinfo)
+	return NewWithConfig(dir, Config{})
+}
+
+// NewWithConfig creates PackageInfo with the given cfg and then Load the given dir
+func NewWithConfig(dir string, cfg Config) (*PackageInfo, error) {
+	return NewWithCache(dir, NewCache(cfg))
+}
+
+// NewWithCache creates PackageInfo sharing packages in the given cache and then Load the given dir
+func NewWithCache(dir string, c *Cache) (*PackageInfo, error) {
+	pi := newPackageInfo(c, newInfo())
 	err := pi.Load(dir)
 	return pi, err
 }
 
+// NewFilesWithCache creates PackageInfo sharing packages in the given cache and then LoadFiles the given files
+func NewFilesWithCache(files []string, c *Cache) (*PackageInfo, error) {
+	pi := newPackageInfo(c, newInfo())
+	err := pi.LoadFiles(files)
+	return pi, err
+}
+
 // NewPackageInfo creates PackageInfo
 func NewPackageInfo(fset *token.FileSet, tinfo *types.Info) *PackageInfo {
+	return newPackageInfo(newCache(Config{}, fset), tinfo)
+}
+
+func newPackageInfo(c *Cache, tinfo *types.Info) *PackageInfo {
 	return &PackageInfo{
-		fset:  token.NewFileSet(),
+		cache: c,
+		fset:  c.fset,
 		tinfo: tinfo,
 
-		pkgs: make(map[pkgKey]*build.Package),
+		pkgs:     make(map[pkgKey]*build.Package),
+		imports:  make(map[*build.Package][]*build.Package),
+		replaced: make(map[string]bool),
+		srcDirs:  make(map[string]string),
 
 		typesPkgs: make(map[*build.Package]*types.Package),
 		astFiles:  make(map[*build.Package][]*ast.File),
@@ -84,34 +263,68 @@ func NewPackageInfo(fset *token.FileSet, tinfo *types.Info) *PackageInfo {
 
 // Load loads package information of the application given by the dir
 func (ip *PackageInfo) Load(dir string) error {
-	abs, err := filepath.Abs(dir)
+	abs, err := ip.cache.files.abs(dir)
 	if err != nil {
 		return fmt.Errorf("getting absolute path %q: %w", dir, err)
 	}
-	bp, err := build.ImportDir(abs, 0)
+	bp, err := ip.cache.importDir("", abs)
 	if err != nil {
 		return fmt.Errorf("importing %q: %w", abs, err)
 	}
-	ip.rootPackage = bp
 	ip.pkgs[pkgKey{".", abs}] = bp
+	return ip.loadRoot(bp, []string{"."})
+}
+
+// LoadFiles loads package information of the application consisting of the
+// given files in a directory like `go run file.go`.  Build constraints of
+// the files are ignored.
+func (ip *PackageInfo) LoadFiles(files []string) error {
+	bp, err := ip.cache.importFiles(files)
+	if err != nil {
+		return fmt.Errorf("importing %s: %w", strings.Join(files, " "), err)
+	}
+	var patterns []string
+	for _, f := range bp.GoFiles {
+		patterns = append(patterns, filepath.Join(bp.Dir, f))
+	}
+	return ip.loadRoot(bp, patterns)
+}
+
+// loadRoot loads the given root package and the packages it imports.  The
+// patterns are passed to the go command to find the package in Modules mode.
+func (ip *PackageInfo) loadRoot(bp *build.Package, patterns []string) error {
+	if ip.cache.cfg.Modules {
+		if ip.cache.files.hasFS() {
+			return fmt.Errorf("loading modules: not supported for FS")
+		}
+		err := ip.loadModules(bp, patterns)
+		if err != nil {
+			return fmt.Errorf("loading modules: %w", err)
+		}
+	}
+	ip.rootPackage = bp
 	ip.pkgs[pkgKey{bp.ImportPath, "."}] = bp
 
-	tp, err := ip.typeCheck(bp)
+	var err error
+	if ip.cache.cfg.Parallel {
+		err = ip.loadParallel(bp)
+	} else {
+		_, err = ip.load(bp)
+	}
 	if err != nil {
 		return fmt.Errorf("type checking: %w", err)
 	}
-	ip.typesPkgs[bp] = tp
 
 	return nil
 }
 
-// Packages returns a slice of *build.Packages that are depended by the loaded package and non standard ones.
+// Packages returns a slice of *build.Packages that are depended by the loaded package and non external ones.
 func (ip *PackageInfo) Packages() []*build.Package {
 	if ip.pkgSlice != nil {
 		return ip.pkgSlice
 	}
 	var res []*build.Package
-	ip.WalkPackages(func(bp *build.Package) bool { return bp.Goroot }, nil, func(bp *build.Package, _ *types.Package, _ []*ast.File) {
+	ip.WalkPackages(ip.IsExternal, nil, func(bp *build.Package, _ *types.Package, _ []*ast.File) {
 		res = append(res, bp)
 	})
 	ip.pkgSlice = res
@@ -131,6 +344,59 @@ func (ip *PackageInfo) AllPackages() []*build.Package {
 	return res
 }
 
+// SourceFiles returns the abs paths of the directories and the files of the
+// non-standard packages including cgo ones, which change the application if
+// they are changed.  They are the files of the packages found so far if
+// loading has failed.
+func (ip *PackageInfo) SourceFiles() []string {
+	var res []string
+	seen := make(map[*build.Package]bool)
+	add := func(bp *build.Package) {
+		if bp == nil || bp.Goroot || bp == fakeCbpkg || seen[bp] {
+			return
+		}
+		seen[bp] = true
+		res = append(res, bp.Dir)
+		for _, fs := range [][]string{bp.GoFiles, bp.CgoFiles, bp.CFiles, bp.CXXFiles, bp.HFiles, bp.SFiles} {
+			for _, f := range fs {
+				res = append(res, filepath.Join(bp.Dir, f))
+			}
+		}
+	}
+	add(ip.rootPackage)
+	for _, bp := range ip.pkgs {
+		add(bp)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// IsExternal reports whether the package is imported by the combined source
+// instead of being combined: it is standard but not in Config.Inline, or
+// matches Config.Keep.
+func (ip *PackageInfo) IsExternal(bp *build.Package) bool {
+	if bp.Goroot {
+		return !ip.cache.inlined(bp)
+	}
+	return bp != ip.rootPackage && MatchPatterns(ip.cache.cfg.Keep, bp.ImportPath)
+}
+
+// MatchPatterns reports whether the importPath matches any of the patterns.
+// A pattern is an import path, or one ending with "/..." which also matches
+// the packages under it.
+func MatchPatterns(patterns []string, importPath string) bool {
+	for _, pat := range patterns {
+		if prefix, ok := strings.CutSuffix(pat, "/..."); ok {
+			if importPath == prefix || strings.HasPrefix(importPath, prefix+"/") {
+				return true
+			}
+		} else if importPath == pat {
+			return true
+		}
+	}
+	return false
+}
+
 // Root() returns the package that is in the directory given on Load().
 func (ip *PackageInfo) Root() *build.Package {
 	return ip.rootPackage
@@ -147,12 +413,8 @@ func (ip *PackageInfo) TypesInfo() *types.Info {
 }
 
 // GetBuildPackage() returns the *build.Package coresponds for the given importPath on the given dir.
-func (ip *PackageInfo) GetBuildPackage(importPath, dir string) *build.Package {
-	bp, err := ip.getBuildPackage(importPath, dir)
-	if err != nil {
-		panic(err)
-	}
-	return bp
+func (ip *PackageInfo) GetBuildPackage(importPath, dir string) (*build.Package, error) {
+	return ip.getBuildPackage(importPath, dir)
 }
 
 // GetTypesPackage() returns the *type.Package for the package specified by the given bp.
@@ -184,12 +446,7 @@ func (ip *PackageInfo) WalkPackages(prune func(*build.Package) bool, pre Walker,
 		if pre != nil {
 			pre(bp, ip.typesPkgs[bp], ip.astFiles[bp])
 		}
-		for _, ipath := range bp.Imports {
-			next, err := ip.getBuildPackage(ipath, bp.ImportPath)
-			if err != nil {
-				msg := fmt.Sprintf("package %q not found on %q", ipath, bp.ImportPath)
-				panic(msg)
-			}
+		for _, next := range ip.imports[bp] {
 			rec(next)
 		}
 		if post != nil {
@@ -200,27 +457,57 @@ func (ip *PackageInfo) WalkPackages(prune func(*build.Package) bool, pre Walker,
 }
 
 // getBuildPackage finds *build.Packages matched to the given importPath on the given dir.
+// The importPath is replaced as given by Config.Replace.
 func (pi *PackageInfo) getBuildPackage(importPath, dir string) (*build.Package, error) {
+	repl, ok := pi.cache.cfg.Replace[importPath]
+	if !ok || dir == repl {
+		return pi.findBuildPackage(importPath, dir)
+	}
+	bp, err := pi.findBuildPackage(repl, dir)
+	if err != nil {
+		return nil, fmt.Errorf("finding replacement %q: %w", repl, err)
+	}
+	if !pi.replaced[importPath] {
+		if err := pi.checkReplacement(importPath, dir, bp); err != nil {
+			return nil, err
+		}
+		pi.replaced[importPath] = true
+	}
+	return bp, nil
+}
+
+// findBuildPackage is the same as getBuildPackage but it doesn't replace the importPath.
+func (pi *PackageInfo) findBuildPackage(importPath, dir string) (*build.Package, error) {
 	key := pkgKey{importPath, dir}
 	if bp, ok := pi.pkgs[key]; ok {
 		return bp, nil
 	}
+	if bp, ok := pi.pkgs[pkgKey{importPath, ""}]; ok {
+		// replacements loaded by loadModules()
+		return bp, nil
+	}
 
 	var bp *build.Package
 	if importPath == "C" {
 		// Always returns fake package for importPath "C" on any directory because "C" package doesn't exist
 		bp = fakeCbpkg
+	} else if pi.cache.cfg.Modules && !(pi.cache.cfg.GOROOT != "" && pi.cache.isStandard(importPath, dir)) {
+		// All packages are resolved by loadModules() in advance except
+		// standard packages in another GOROOT
+		return nil, fmt.Errorf("package %q imported on %q is not in the loaded package graph", importPath, dir)
 	} else {
-		abs, err := getImportDirAbs(importPath, dir)
+		abs, err := pi.cache.findDir(importPath, pi.srcDir(dir))
+		if err != nil {
+			return nil, err
+		}
 		absKey := pkgKey{".", abs}
 		var ok bool
 		bp, ok = pi.pkgs[absKey]
 		if !ok {
-			bp, err = build.ImportDir(abs, build.AllowBinary)
+			bp, err = pi.cache.importDir(importPath, abs)
 			if err != nil {
 				return nil, err
 			}
-			bp.ImportPath = importPath
 			pi.pkgs[absKey] = bp
 		}
 	}
@@ -235,6 +522,24 @@ func (ip *PackageInfo) Import(path string) (*types.Package, error) {
 	return ip.ImportFrom(path, ".", 0)
 }
 
+// addSrcDir records the real dir of bp importing other packages, see srcDir()
+func (pi *PackageInfo) addSrcDir(bp *build.Package) {
+	pi.srcDirs[bp.ImportPath] = bp.Dir
+	if bp.Name == "main" {
+		pi.srcDirs["."] = bp.Dir
+	}
+}
+
+// srcDir returns the real dir of the importer for the dir passed to
+// getBuildPackage() so that imports are resolved in the module of the
+// importer.  The dir itself is returned if it is unknown.
+func (pi *PackageInfo) srcDir(dir string) string {
+	if d, ok := pi.srcDirs[dir]; ok {
+		return d
+	}
+	return dir
+}
+
 // Import imports package specified by the given path and dir, then returns its type information
 // The mode must be set 0. It is reserved for future use.
 func (ip *PackageInfo) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
@@ -242,74 +547,80 @@ func (ip *PackageInfo) ImportFrom(path, dir string, mode types.ImportMode) (*typ
 	if err != nil {
 		return nil, fmt.Errorf("getting *build.Package for %q on %q: %w", path, dir, err)
 	}
+	return ip.load(bp)
+}
+
+// load loads the package specified by the given bp and the packages it imports.
+// Packages in the cache are reused unless they or their imports have been changed.
+func (ip *PackageInfo) load(bp *build.Package) (*types.Package, error) {
 	if tp, ok := ip.typesPkgs[bp]; ok {
 		return tp, nil
 	}
 
-	tp, err := ip.typeCheck(bp)
-	if err != nil {
-		return nil, err
-	}
-
-	ip.typesPkgs[bp] = tp
-
-	return tp, nil
-}
-
-func (ip *PackageInfo) typeCheck(bp *build.Package) (*types.Package, error) {
 	if bp.Goroot && bp.ImportPath == "unsafe" {
+		ip.typesPkgs[bp] = types.Unsafe
 		return types.Unsafe, nil
 	}
 
-	files, err := parsePackage(ip.fset, bp)
-	if err != nil {
-		return nil, fmt.Errorf("parsing package: %w", err)
-	}
-
-	var hardErrors, softErrors []error
-	tcfg := types.Config{
-		IgnoreFuncBodies: bp.Goroot, // doesn't check function body if the package is standard (in GOROOT/src)
-		FakeImportC:      true,
-		Error: func(err error) {
-			if terr, ok := err.(types.Error); ok && !terr.Soft {
-				hardErrors = append(hardErrors, err)
-			} else {
-				softErrors = append(softErrors, err)
-			}
-		},
-		Importer: ip,
-	}
-
-	tp, err := tcfg.Check(bp.ImportPath, ip.fset, files, ip.tinfo)
-	if err != nil {
-		if 0 < len(hardErrors) {
-			return nil, fmt.Errorf("type checking: %w", hardErrors[0])
-		} else {
-			return nil, fmt.Errorf("type checking: %w", err)
+	if ip.cache.std != nil && bp.Goroot && bp != fakeCbpkg {
+		tp, err := ip.cache.importStd(bp.ImportPath)
+		if err != nil {
+			return nil, fmt.Errorf("importing export data of %q: %w", bp.ImportPath, err)
 		}
+		ip.typesPkgs[bp] = tp
+		return tp, nil
 	}
 
-	var imps []*types.Package
+	ip.addSrcDir(bp)
+	var ibps []*build.Package
 	for _, ipath := range bp.Imports {
 		ibp, err := ip.getBuildPackage(ipath, bp.ImportPath)
 		if err != nil {
 			return nil, fmt.Errorf("getting *build.Package for %q on %q: %w", ipath, bp.ImportPath, err)
 		}
-		p, ok := ip.typesPkgs[ibp]
-		if !ok || p == nil {
+		ibps = append(ibps, ibp)
+	}
+
+	if ip.cache.std != nil {
+		// find export data of all standard packages imported here at once
+		var stdPaths []string
+		for _, ibp := range ibps {
+			if ibp.Goroot && ibp != fakeCbpkg {
+				stdPaths = append(stdPaths, ibp.ImportPath)
+			}
+		}
+		if err := ip.cache.prefetchStd(stdPaths); err != nil {
+			return nil, fmt.Errorf("finding export data: %w", err)
+		}
+	}
+
+	// load the imported packages first to know whether the cached one is still valid
+	var imps []*types.Package
+	for _, ibp := range ibps {
+		if ibp == fakeCbpkg {
 			continue
 		}
-		imps = append(imps, p)
+		tp, err := ip.load(ibp)
+		if err != nil {
+			return nil, fmt.Errorf("loading %q: %w", ibp.ImportPath, err)
+		}
+		imps = append(imps, tp)
+	}
+
+	cp, err := ip.cache.check(bp, ip, imps)
+	if err != nil {
+		return nil, err
 	}
-	tp.SetImports(imps)
 
-	ip.astFiles[bp] = files
-	ip.typesPkgs[bp] = tp
+	ip.imports[bp] = ibps
+	ip.astFiles[bp] = cp.files
+	ip.typesPkgs[bp] = cp.tp
+	mergeInfo(ip.tinfo, cp.info)
 
-	return tp, nil
+	return cp.tp, nil
 }
 
-func parsePackage(fset *token.FileSet, bp *build.Package) ([]*ast.File, error) {
+func parsePackage(fset *token.FileSet, bp *build.Package, v *vfs) ([]*ast.File, error) {
 	files := make([]string, 0, len(bp.GoFiles)+len(bp.CgoFiles))
 	for _, f := range bp.GoFiles {
 		files = append(files, f)
@@ -327,7 +638,7 @@ func parsePackage(fset *token.FileSet, bp *build.Package) ([]*ast.File, error) {
 			fname = filepath.Join(bp.ImportPath, f)
 		}
 		path := filepath.Join(bp.Dir, f)
-		af, err := parseFile(fset, fname, path)
+		af, err := parseFile(fset, fname, path, v)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %w", path, err)
 		}
@@ -336,8 +647,8 @@ func parsePackage(fset *token.FileSet, bp *build.Package) ([]*ast.File, error) {
 	return res, nil
 }
 
-func parseFile(fset *token.FileSet, fname, path string) (*ast.File, error) {
-	b, err := ioutil.ReadFile(path)
+func parseFile(fset *token.FileSet, fname, path string, v *vfs) (*ast.File, error) {
+	b, err := v.readFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading: %w", err)
 	}
@@ -349,8 +660,8 @@ func parseFile(fset *token.FileSet, fname, path string) (*ast.File, error) {
 }
 
 // getImportDirAbs finds abs path of the package pointed by the gvien importPath on the given dir.
-func getImportDirAbs(importPath, dir string) (string, error) {
-	bp, err := build.Import(importPath, dir, build.FindOnly)
+func getImportDirAbs(ctxt *build.Context, importPath, dir string) (string, error) {
+	bp, err := ctxt.Import(importPath, dir, build.FindOnly)
 	if err != nil {
 		return "", fmt.Errorf("finding %q on %q: %w", importPath, dir, err)
 	}
@@ -0,0 +1,111 @@
+package pkginfo
+
+import (
+	"fmt"
+	"go/build"
+	"go/types"
+	"strings"
+)
+
+// checkReplacement checks that the replacement rbp has the API of the
+// package of the importPath on the dir.  Both of them are loaded.
+func (ip *PackageInfo) checkReplacement(importPath, dir string, rbp *build.Package) error {
+	obp, err := ip.findBuildPackage(importPath, dir)
+	if err != nil {
+		return fmt.Errorf("finding %q replaced by %q: %w", importPath, rbp.ImportPath, err)
+	}
+	otp, err := ip.load(obp)
+	if err != nil {
+		return fmt.Errorf("loading %q replaced by %q: %w", importPath, rbp.ImportPath, err)
+	}
+	rtp, err := ip.load(rbp)
+	if err != nil {
+		return fmt.Errorf("loading replacement %q: %w", rbp.ImportPath, err)
+	}
+	if diffs := diffAPI(otp, rtp); 0 < len(diffs) {
+		return fmt.Errorf("API of replacement %q differs from %q: %s", rbp.ImportPath, importPath, strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// diffAPI returns the differences of the exported API of the package repl
+// from the one of the package orig.  Additional identifiers in repl are not
+// differences.
+func diffAPI(orig, repl *types.Package) []string {
+	var diffs []string
+	for _, name := range orig.Scope().Names() {
+		oobj := orig.Scope().Lookup(name)
+		if !oobj.Exported() {
+			continue
+		}
+		robj := repl.Scope().Lookup(name)
+		if robj == nil {
+			diffs = append(diffs, fmt.Sprintf("%s is missing", name))
+			continue
+		}
+		if want, got := objectString(oobj), objectString(robj); want != got {
+			diffs = append(diffs, fmt.Sprintf("%s is %s, want %s", name, got, want))
+			continue
+		}
+		if _, ok := oobj.(*types.TypeName); !ok {
+			continue
+		}
+		// methods including ones of the pointer receiver
+		rmset := types.NewMethodSet(types.NewPointer(robj.Type()))
+		omset := types.NewMethodSet(types.NewPointer(oobj.Type()))
+		for i := 0; i < omset.Len(); i++ {
+			om := omset.At(i).Obj()
+			if !om.Exported() {
+				continue
+			}
+			rsel := rmset.Lookup(om.Pkg(), om.Name())
+			if rsel == nil {
+				diffs = append(diffs, fmt.Sprintf("method %s.%s is missing", name, om.Name()))
+			} else if want, got := objectString(om), objectString(rsel.Obj()); want != got {
+				diffs = append(diffs, fmt.Sprintf("method %s.%s is %s, want %s", name, om.Name(), got, want))
+			}
+		}
+	}
+	return diffs
+}
+
+// objectString returns the exported API of the obj with identifiers of its
+// own package unqualified, so that ones of the replaced package and of the
+// replacement can be compared.  Unexported fields and values of constants
+// are not a part of the API.
+func objectString(obj types.Object) string {
+	qf := func(p *types.Package) string {
+		if p == obj.Pkg() {
+			return ""
+		}
+		return p.Path()
+	}
+	switch obj := obj.(type) {
+	case *types.Const:
+		return "const " + types.TypeString(obj.Type(), qf)
+	case *types.TypeName:
+		var b strings.Builder
+		b.WriteString("type")
+		if named, ok := obj.Type().(*types.Named); ok {
+			for i := 0; i < named.TypeParams().Len(); i++ {
+				tp := named.TypeParams().At(i)
+				fmt.Fprintf(&b, " [%s %s]", tp.Obj().Name(), types.TypeString(tp.Constraint(), qf))
+			}
+		}
+		st, ok := obj.Type().Underlying().(*types.Struct)
+		if !ok {
+			b.WriteString(" " + types.TypeString(obj.Type().Underlying(), qf))
+			return b.String()
+		}
+		b.WriteString(" struct{")
+		for i := 0; i < st.NumFields(); i++ {
+			if f := st.Field(i); f.Exported() {
+				fmt.Fprintf(&b, " %s %s;", f.Name(), types.TypeString(f.Type(), qf))
+			}
+		}
+		b.WriteString(" }")
+		return b.String()
+	default:
+		return types.ObjectString(obj, qf)
+	}
+}
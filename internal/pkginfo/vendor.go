@@ -0,0 +1,98 @@
+package pkginfo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// findVendorDir finds abs path of the package pointed by the given importPath
+// imported on the dir like `go build -mod=vendor`: packages in the main
+// module are in its directory and the others are in its vendor directory if
+// they are listed in vendor/modules.txt.  The main module is the one
+// containing the dir of the importer, which may be in the vendor directory.
+func findVendorDir(importPath, dir string) (string, error) {
+	abs, err := findVendorDirAbs(importPath, dir)
+	if err != nil {
+		return "", fmt.Errorf("finding %q in the vendor directory: %w", importPath, err)
+	}
+	return abs, nil
+}
+
+func findVendorDirAbs(importPath, dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := dir; d != filepath.Dir(d); d = filepath.Dir(d) {
+		if filepath.Base(d) == "vendor" && isFile(filepath.Join(d, "modules.txt")) {
+			// go.mod files of vendored packages are ignored
+			dir = filepath.Dir(d)
+			break
+		}
+	}
+	root, modPath, err := findMainModule(dir)
+	if err != nil {
+		return "", err
+	}
+	if importPath == modPath || strings.HasPrefix(importPath, modPath+"/") {
+		return filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(importPath, modPath))), nil
+	}
+
+	modulesTxt := filepath.Join(root, "vendor", "modules.txt")
+	listed, err := isVendored(modulesTxt, importPath)
+	if err != nil {
+		return "", err
+	}
+	if !listed {
+		return "", fmt.Errorf("package %q is not listed in %s", importPath, modulesTxt)
+	}
+	return filepath.Join(root, "vendor", filepath.FromSlash(importPath)), nil
+}
+
+// findMainModule returns the root directory and the path of the module
+// governing the given dir
+func findMainModule(dir string) (string, string, error) {
+	for d := dir; ; d = filepath.Dir(d) {
+		gomod := filepath.Join(d, "go.mod")
+		b, err := os.ReadFile(gomod)
+		if err == nil {
+			modPath := modfile.ModulePath(b)
+			if modPath == "" {
+				return "", "", fmt.Errorf("no module path in %s", gomod)
+			}
+			return d, modPath, nil
+		}
+		if d == filepath.Dir(d) {
+			return "", "", fmt.Errorf("go.mod not found in %q or its parents", dir)
+		}
+	}
+}
+
+// isVendored reports whether the importPath is listed as a package in the
+// given modules.txt
+func isVendored(modulesTxt, importPath string) (bool, error) {
+	f, err := os.Open(modulesTxt)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// lines for modules start with "#" and the others are import paths
+		if strings.TrimSpace(s.Text()) == importPath {
+			return true, nil
+		}
+	}
+	return false, s.Err()
+}
+
+func isFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
@@ -0,0 +1,283 @@
+package pkginfo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+// fsRoot is the directory where Config.FS is mounted.  It appears in the
+// paths of the files in the FS, e.g. bp.Dir, instead of any real directory.
+var fsRoot = filepath.Join(string(filepath.Separator), "gottani-fs")
+
+// vfs is the file system which sources are read from.  It is the disk, or
+// fsys mounted on fsRoot if given, and the files in overlay take precedence
+// over them.  The nil *vfs is the disk.
+type vfs struct {
+	overlay map[string][]byte // abs path => contents
+	fsys    fs.FS
+
+	modsOnce sync.Once
+	mods     []fsModule // modules in fsys sorted by the length of paths in descending order
+	modsErr  error
+}
+
+// fsModule is a module in the fsys
+type fsModule struct {
+	path string // module path
+	dir  string // slash-separated path in the fsys
+}
+
+// newVFS creates vfs with the given overlay and fsys.  It returns nil if both
+// of them are empty.
+func newVFS(overlay map[string][]byte, fsys fs.FS) *vfs {
+	if len(overlay) == 0 && fsys == nil {
+		return nil
+	}
+	v := &vfs{fsys: fsys}
+	if 0 < len(overlay) {
+		v.overlay = make(map[string][]byte, len(overlay))
+		for path, b := range overlay {
+			if abs, err := v.abs(path); err == nil {
+				path = abs
+			}
+			v.overlay[path] = b
+		}
+	}
+	return v
+}
+
+// hasFS reports whether the sources are read from fsys instead of the disk
+func (v *vfs) hasFS() bool {
+	return v != nil && v.fsys != nil
+}
+
+// abs returns the abs path of the given path.  Paths are relative to the
+// root of fsys if it is given.
+func (v *vfs) abs(path string) (string, error) {
+	if v.hasFS() && !filepath.IsAbs(path) {
+		return filepath.Join(fsRoot, filepath.FromSlash(path)), nil
+	}
+	return filepath.Abs(path)
+}
+
+// fsPath returns the path in fsys for the given abs path if it is there
+func (v *vfs) fsPath(abs string) (string, bool) {
+	if !v.hasFS() {
+		return "", false
+	}
+	rel, err := filepath.Rel(fsRoot, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// immutable reports whether the file never changes while the vfs is used
+func (v *vfs) immutable(path string) bool {
+	if v == nil {
+		return false
+	}
+	if _, ok := v.overlay[path]; ok {
+		return true
+	}
+	_, ok := v.fsPath(path)
+	return ok
+}
+
+// setup makes the ctxt read files through v
+func (v *vfs) setup(ctxt *build.Context) {
+	if v == nil {
+		return
+	}
+	ctxt.IsDir = v.isDir
+	ctxt.ReadDir = v.readDir
+	ctxt.OpenFile = v.openFile
+}
+
+func (v *vfs) readFile(path string) ([]byte, error) {
+	if v == nil {
+		return os.ReadFile(path)
+	}
+	if b, ok := v.overlay[path]; ok {
+		return b, nil
+	}
+	if name, ok := v.fsPath(path); ok {
+		return fs.ReadFile(v.fsys, name)
+	}
+	return os.ReadFile(path)
+}
+
+func (v *vfs) openFile(path string) (io.ReadCloser, error) {
+	if v == nil {
+		return os.Open(path)
+	}
+	if b, ok := v.overlay[path]; ok {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	if name, ok := v.fsPath(path); ok {
+		return v.fsys.Open(name)
+	}
+	return os.Open(path)
+}
+
+// combinedHeader is the beginning of sources combined by gottani
+const combinedHeader = "// Code generated by Gottani;"
+
+// isCombined reports whether the file is a source combined by gottani
+func (v *vfs) isCombined(path string) bool {
+	f, err := v.openFile(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	b := make([]byte, len(combinedHeader))
+	if _, err := io.ReadFull(f, b); err != nil {
+		return false
+	}
+	return string(b) == combinedHeader
+}
+
+func (v *vfs) stat(path string) (fs.FileInfo, error) {
+	if name, ok := v.fsPath(path); ok {
+		return fs.Stat(v.fsys, name)
+	}
+	return os.Stat(path)
+}
+
+// hasDir reports whether the dir contains any file in the overlay
+func (v *vfs) hasDir(dir string) bool {
+	if v == nil {
+		return false
+	}
+	for path := range v.overlay {
+		if filepath.Dir(path) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *vfs) isDir(path string) bool {
+	if fi, err := v.stat(path); err == nil {
+		return fi.IsDir()
+	}
+	return v.hasDir(path)
+}
+
+// readDir lists the files in the dir and ones only in the overlay
+func (v *vfs) readDir(dir string) ([]fs.FileInfo, error) {
+	var ents []fs.DirEntry
+	var err error
+	if name, ok := v.fsPath(dir); ok {
+		ents, err = fs.ReadDir(v.fsys, name)
+	} else {
+		ents, err = os.ReadDir(dir)
+	}
+	if err != nil && !v.hasDir(dir) {
+		return nil, err
+	}
+	exists := make(map[string]bool)
+	var res []fs.FileInfo
+	for _, ent := range ents {
+		fi, err := ent.Info()
+		if err != nil {
+			return nil, err
+		}
+		exists[ent.Name()] = true
+		res = append(res, fi)
+	}
+	if v != nil {
+		for path, b := range v.overlay {
+			if name := filepath.Base(path); filepath.Dir(path) == dir && !exists[name] {
+				res = append(res, overlayFileInfo{name: name, size: int64(len(b))})
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name() < res[j].Name() })
+	return res, nil
+}
+
+// findDir finds abs path of the package pointed by the given importPath in
+// fsys.  A package is found in the module containing it, or in the directory
+// of the importPath as in GOPATH/src unless it is standard.  It returns ""
+// if not found.
+func (v *vfs) findDir(importPath string, standard bool) (string, error) {
+	v.modsOnce.Do(v.loadModules)
+	if v.modsErr != nil {
+		return "", fmt.Errorf("finding modules in FS: %w", v.modsErr)
+	}
+
+	var dir string
+	for _, m := range v.mods {
+		if importPath == m.path || strings.HasPrefix(importPath, m.path+"/") {
+			dir = path.Join(m.dir, strings.TrimPrefix(importPath, m.path))
+			break
+		}
+	}
+	if dir == "" && !standard {
+		dir = importPath
+	}
+	if dir == "" {
+		return "", nil
+	}
+	if fi, err := fs.Stat(v.fsys, dir); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("cannot find package %q in FS", importPath)
+	}
+	return filepath.Join(fsRoot, filepath.FromSlash(dir)), nil
+}
+
+// loadModules collects the modules defined by go.mod files in fsys
+func (v *vfs) loadModules() {
+	v.modsErr = fs.WalkDir(v.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// the go command ignores them
+			if base := d.Name(); name != "." && (base == "vendor" || base == "testdata" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+		b, err := fs.ReadFile(v.fsys, name)
+		if err != nil {
+			return err
+		}
+		modPath := modfile.ModulePath(b)
+		if modPath == "" {
+			return errors.New("no module path in " + name)
+		}
+		v.mods = append(v.mods, fsModule{path: modPath, dir: path.Dir(name)})
+		return nil
+	})
+	sort.SliceStable(v.mods, func(i, j int) bool { return len(v.mods[i].path) > len(v.mods[j].path) })
+}
+
+// overlayFileInfo is fs.FileInfo of a file only in the overlay
+type overlayFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi overlayFileInfo) Name() string       { return fi.name }
+func (fi overlayFileInfo) Size() int64        { return fi.size }
+func (fi overlayFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (fi overlayFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi overlayFileInfo) IsDir() bool        { return false }
+func (fi overlayFileInfo) Sys() any           { return nil }
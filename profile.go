@@ -0,0 +1,110 @@
+package gottani
+
+import (
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ktateish/gottani/internal/pkginfo"
+)
+
+// Profile is a set of restrictions of a judge.  Combine validates the
+// combined source against Options.Profile and fails if it violates any of
+// them.
+type Profile struct {
+	// Name is the name of the profile used in errors.
+	Name string `toml:"-" json:"-"`
+
+	// GoVersion is the Go version of the judge.  It is used as
+	// Options.GoVersion unless the latter is given.
+	GoVersion string `toml:"go" json:"go"`
+
+	// Allowed are the import paths of non-standard packages which the judge
+	// provides, so that they may stay as imports.  A path ending with "/..."
+	// matches the packages under it as well.
+	Allowed []string `toml:"allowed" json:"allowed"`
+
+	// Forbidden are the import paths of packages which must not be imported,
+	// in the same form as Allowed.
+	Forbidden []string `toml:"forbidden" json:"forbidden"`
+
+	// MaxSize is the limit of the source size in bytes.  Zero means no limit.
+	MaxSize int `toml:"max_size" json:"max_size"`
+}
+
+// Profiles are the bundled profiles of judges, which can be overridden by
+// the ones in config files.  Check the judges for their current settings.
+var Profiles = map[string]*Profile{
+	"atcoder": {
+		Name:      "atcoder",
+		GoVersion: "go1.20",
+		Allowed: []string{
+			"github.com/emirpasic/gods/...",
+			"github.com/liyue201/gostl/...",
+			"golang.org/x/exp/...",
+			"gonum.org/v1/gonum/...",
+		},
+		MaxSize: 512 * 1024,
+	},
+	"codeforces": {
+		Name:      "codeforces",
+		GoVersion: "go1.22",
+		MaxSize:   64 * 1024,
+	},
+	"yukicoder": {
+		Name:      "yukicoder",
+		GoVersion: "go1.22",
+		MaxSize:   64 * 1024,
+	},
+}
+
+// ProfileNames returns the sorted names of the bundled profiles.
+func ProfileNames() []string {
+	return slices.Sorted(maps.Keys(Profiles))
+}
+
+// ErrProfile is wrapped by the errors of combined sources violating
+// Options.Profile.
+var ErrProfile = errors.New("violating the judge profile")
+
+// Validate checks the combined src against the profile.  Packages in the
+// local GOROOT are taken as standard ones.
+func (p *Profile) Validate(src []byte) error {
+	return p.validate(src, "")
+}
+
+// validate checks the combined src against the profile taking the packages
+// in goroot as standard ones.  The local GOROOT is used if goroot is empty.
+func (p *Profile) validate(src []byte, goroot string) error {
+	var problems []string
+	if 0 < p.MaxSize && p.MaxSize < len(src) {
+		problems = append(problems, fmt.Sprintf("the size %d bytes exceeds the limit %d bytes", len(src), p.MaxSize))
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		return fmt.Errorf("parsing combined source: %w", err)
+	}
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return fmt.Errorf("parsing combined source: %w", err)
+		}
+		switch {
+		case pkginfo.MatchPatterns(p.Forbidden, path):
+			problems = append(problems, fmt.Sprintf("package %q is forbidden", path))
+		case !pkginfo.IsStandardPath(goroot, path) && path != "C" && !pkginfo.MatchPatterns(p.Allowed, path):
+			problems = append(problems, fmt.Sprintf("package %q is not provided", path))
+		}
+	}
+
+	if 0 < len(problems) {
+		return fmt.Errorf("%w %s: %s", ErrProfile, p.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/ktateish/gottani/testdata/deadcode
+
+go 1.23
@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+)
+
+const debug = false
+
+const useFastIO = true
+
+const mode = 2
+
+// Sum returns the sum of the xs
+func Sum(xs []int) int {
+	total := 0
+	for i, x := range xs {
+		if debug {
+			// dump every step
+			dump(i, total)
+		}
+		total += x
+	}
+	return total
+}
+
+func dump(i, total int) {
+	fmt.Fprintln(os.Stderr, "step", i, total)
+}
+
+// Read returns the reader name
+func Read() string {
+	if n := len("fast"); useFastIO {
+		return fastRead(n)
+	} else {
+		return slowRead()
+	}
+}
+
+func fastRead(n int) string {
+	return fmt.Sprint("fast", n)
+}
+
+func slowRead() string {
+	return "slow"
+}
+
+// Mode returns the name of the mode
+func Mode() string {
+	name := "unknown"
+	switch mode {
+	case 1:
+		name = modeOne()
+	case 2:
+		name = "two"
+	default:
+		name = modeOther()
+	}
+	switch {
+	case debug:
+		name = modeOther()
+	case len(name) > 10:
+		name = name[:10]
+	}
+	return name
+}
+
+func modeOne() string {
+	return "one"
+}
+
+func modeOther() string {
+	return "other"
+}
+
+// Check returns whether x is positive
+func Check(x int) bool {
+	trace := fmt.Sprintf("check %d", x)
+	if !debug {
+		return x > 0
+	} else if x > 100 {
+		println(trace)
+	}
+	return false
+}
+
+// Large returns whether x is large
+func Large(x int) bool {
+	if x > 100 {
+		return true
+	} else if debug {
+		dump(x, 0)
+	}
+	return false
+}
+
+// Loop returns the number of the loop
+func Loop() int {
+	n := 0
+outer:
+	for {
+		n++
+		if debug {
+			continue outer
+		}
+		if n > 2 {
+			break
+		}
+	}
+	return n
+}
+
+// Verbose returns a function printing if debug is enabled
+var Verbose = func(s string) {
+	if debug {
+		dump(len(s), 0)
+	}
+}
+
+// Nested returns x
+func Nested(x int) int {
+	y := x * 2
+	if debug {
+		if useFastIO {
+			dump(y, 0)
+		}
+	}
+	return x
+}
+
+// Pick returns v changed by the mode
+func Pick(v int) int {
+	if false {
+		dump(v, 0)
+	}
+	switch mode {
+	case 1:
+		return v - 1
+	case 2:
+		return v + 1
+	default:
+		return v * 2
+	}
+}
+
+// Sign returns the sign of v
+func Sign(v int) string {
+	w := v * 3
+	switch {
+	case debug:
+		dump(w, 0)
+		return "debug"
+	case v < 0:
+		return "negative"
+	default:
+		return "positive"
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ktateish/gottani/testdata/deadcode/lib"
+)
+
+func main() {
+	lib.Verbose("start")
+	fmt.Println(lib.Sum([]int{1, 2, 3}), lib.Read(), lib.Mode(), lib.Check(3), lib.Loop(), lib.Large(3), lib.Nested(5), lib.Pick(3), lib.Sign(-1))
+}
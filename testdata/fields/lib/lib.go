@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Counter counts values.
+type Counter struct {
+	name  string      // debug name
+	mu    sync.Mutex  // unused lock
+	cache map[int]int // lazily built cache
+	hits  int
+	total int
+}
+
+func NewCounter(name string) *Counter {
+	return &Counter{name, sync.Mutex{}, nil, 0, 0}
+}
+
+func (c *Counter) Add(n int) {
+	c.total += n
+}
+
+func (c *Counter) Total() int {
+	return c.total
+}
+
+func (c *Counter) Hits() int {
+	c.hits++
+	return c.hits
+}
+
+// Pair is printed as a whole.
+type Pair struct {
+	A, B int
+	note string
+}
+
+type Point struct {
+	X, Y, Z int
+}
+
+type Item struct {
+	id, weight int
+	label      string
+}
+
+func NewItem(id int) Item {
+	return Item{id, weight(id), "item"}
+}
+
+func (it Item) ID() int {
+	return it.id
+}
+
+func weight(id int) int {
+	fmt.Println("weight", id)
+	return id * 10
+}
+
+type Key struct {
+	a, b int
+}
+
+type Box[T any] struct {
+	val  T
+	hits int
+}
+
+func NewBox[T any](v T) *Box[T] {
+	return &Box[T]{v, 0}
+}
+
+func (b *Box[T]) Get() T {
+	return b.val
+}
+
+// Grid has values from local variables which are used only by them.
+type Grid struct {
+	cells []int
+	name  string
+	area  func() int
+}
+
+func NewGrid(n int) *Grid {
+	name := "grid"
+	size := n * n
+	return &Grid{make([]int, n), name, func() int { return size }}
+}
+
+func (g *Grid) Len() int {
+	return len(g.cells)
+}
+
+// Seg is sorted through sort.Interface.
+type Seg struct {
+	xs    []int
+	title string
+}
+
+func NewSeg(xs ...int) *Seg {
+	return &Seg{xs, "seg"}
+}
+
+func (s *Seg) Len() int           { return len(s.xs) }
+func (s *Seg) Less(i, j int) bool { return s.xs[i] < s.xs[j] }
+func (s *Seg) Swap(i, j int)      { s.xs[i], s.xs[j] = s.xs[j], s.xs[i] }
+func (s *Seg) Min() int           { return s.xs[0] }
+
+func (s *Seg) String() string {
+	return s.title
+}
+
+func (s *Seg) Title() string {
+	return s.title
+}
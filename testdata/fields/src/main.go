@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ktateish/gottani/testdata/fields/lib"
+)
+
+func main() {
+	c := lib.NewCounter("c")
+	c.Add(3)
+	fmt.Println(c.Total())
+
+	fmt.Println(lib.Pair{A: 1, B: 2})
+
+	p := lib.Point{1, 2, 3}
+	fmt.Println(p.X + p.Y)
+
+	it := lib.NewItem(4)
+	fmt.Println(it.ID())
+
+	m := map[lib.Key]int{}
+	m[lib.Key{}]++
+	fmt.Println(len(m))
+
+	fmt.Println(lib.NewBox("box").Get())
+
+	s := lib.NewSeg(3, 1, 2)
+	sort.Sort(s)
+	fmt.Println(s.Min())
+
+	fmt.Println(lib.NewGrid(3).Len())
+}
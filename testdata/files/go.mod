@@ -0,0 +1,3 @@
+module github.com/ktateish/gottani/testdata/files
+
+go 1.23
@@ -0,0 +1,21 @@
+package lib
+
+// Sum returns the sum of xs
+func Sum(xs ...int) int {
+	s := 0
+	for _, x := range xs {
+		s += x
+	}
+	return s
+}
+
+// Max returns the maximum of xs
+func Max(xs ...int) int {
+	m := xs[0]
+	for _, x := range xs[1:] {
+		if m < x {
+			m = x
+		}
+	}
+	return m
+}
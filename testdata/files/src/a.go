@@ -0,0 +1,14 @@
+//go:build ignore
+
+// Problem A
+package main
+
+import (
+	"fmt"
+
+	"github.com/ktateish/gottani/testdata/files/lib"
+)
+
+func main() {
+	fmt.Println(lib.Sum(1, 2, 3))
+}
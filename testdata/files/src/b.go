@@ -0,0 +1,14 @@
+//go:build ignore
+
+// Problem B
+package main
+
+import (
+	"fmt"
+
+	"github.com/ktateish/gottani/testdata/files/lib"
+)
+
+func main() {
+	fmt.Println(lib.Max(3, 1, 4, 1, 5))
+}
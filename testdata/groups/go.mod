@@ -0,0 +1,3 @@
+module github.com/ktateish/gottani/testdata/groups
+
+go 1.23
@@ -0,0 +1,44 @@
+package lib
+
+import "fmt"
+
+type Kind int
+
+// kinds of tokens
+const (
+	_     Kind = iota
+	Ident      // identifier
+	Number
+	// String is a string literal
+	String
+	Op
+)
+
+func (k Kind) String() string {
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+const (
+	KB = 1 << (10 * (iota + 1))
+	MB
+	GB
+	TB
+)
+
+const (
+	Red, Green = iota * 2, iota*2 + 1
+	Blue, Yellow
+	White, Black
+)
+
+type (
+	Point struct{ X, Y int }
+	Rect  struct{ Min, Max Point }
+	Line  struct{ From, To Point }
+)
+
+var (
+	Names  = []string{"zero", "one"}
+	Primes = []int{2, 3, 5, 7}
+	Table  = map[string]int{"a": 1}
+)
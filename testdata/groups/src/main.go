@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ktateish/gottani/testdata/groups/lib"
+)
+
+func main() {
+	fmt.Println(lib.Number, lib.String)
+	fmt.Println(lib.GB, lib.TB)
+	fmt.Println(lib.Blue, lib.Black)
+	fmt.Println(lib.Rect{Max: lib.Point{X: 1, Y: 2}})
+	fmt.Println(lib.Primes)
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+)
+
+func main() {
+	next, stop := iter.Pull(slices.Values([]int{1, 2, 3}))
+	defer stop()
+	fmt.Println(next())
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+func main() {
+	m := map[string]int{"b": 2, "a": 1, "c": 3}
+	keys := slices.Sorted(maps.Keys(m))
+	s := []int{3, 1, 2}
+	slices.SortFunc(s, func(a, b int) int { return cmp.Compare(b, a) })
+	fmt.Println(keys, s, slices.Index(s, 1), slices.Max(s))
+}
@@ -13,7 +13,7 @@ func main() {
 	// So this call should not be executed.
 	// It is OK because the purpose of this test is to confirm
 	// that the combined.go can be built without any errors.
-	if false {
+	if a > b {
 		fmt.Printf("%d + %d = %d\n", a, b, lib.Add(a, b))
 	}
 }
@@ -0,0 +1,23 @@
+package fastio
+
+import (
+	"bufio"
+	"os"
+)
+
+// Writer writes outputs with a buffer
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter() *Writer {
+	return &Writer{w: bufio.NewWriter(os.Stdout)}
+}
+
+func (w *Writer) WriteString(s string) {
+	w.w.WriteString(s)
+}
+
+func (w *Writer) Flush() {
+	w.w.Flush()
+}
@@ -0,0 +1,11 @@
+package fastio
+
+type Writer struct{}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+func (w *Writer) WriteString(s string) int {
+	return len(s)
+}
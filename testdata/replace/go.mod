@@ -0,0 +1,3 @@
+module github.com/ktateish/gottani/testdata/replace
+
+go 1.23
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/ktateish/gottani/testdata/replace/fastio"
+)
+
+func main() {
+	w := fastio.NewWriter()
+	defer w.Flush()
+	w.WriteString("hello\n")
+}
@@ -0,0 +1,3 @@
+module github.com/ktateish/gottani/testdata/rta
+
+go 1.23
@@ -0,0 +1,52 @@
+package lib
+
+import "fmt"
+
+type Set[T comparable] struct {
+	m map[T]bool
+}
+
+func NewSet[T comparable]() *Set[T] {
+	return &Set[T]{m: make(map[T]bool)}
+}
+
+func (s *Set[T]) Add(v T) {
+	s.m[v] = true
+}
+
+func (s *Set[T]) Has(v T) bool {
+	return s.m[v]
+}
+
+func (s *Set[T]) Count() int {
+	return len(s.m)
+}
+
+type Vec struct {
+	X, Y int
+}
+
+func (v Vec) String() string {
+	return fmt.Sprintf("(%d, %d)", v.X, v.Y)
+}
+
+func (v Vec) Add(w Vec) Vec {
+	return Vec{v.X + w.X, v.Y + w.Y}
+}
+
+func (v Vec) Scale(k int) Vec {
+	return Vec{v.X * k, v.Y * k}
+}
+
+type Base struct {
+	n int
+}
+
+func (b *Base) Inc() int {
+	b.n++
+	return b.n
+}
+
+func (b *Base) Reset() {
+	b.n = 0
+}
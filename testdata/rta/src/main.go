@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ktateish/gottani/testdata/rta/lib"
+)
+
+type counter struct {
+	lib.Base
+}
+
+type shape interface {
+	area() int
+}
+
+type rect struct {
+	w, h int
+}
+
+func (r rect) area() int {
+	return r.w * r.h
+}
+
+func (r rect) perimeter() int {
+	return 2 * (r.w + r.h)
+}
+
+func (r rect) label() string {
+	return "rect"
+}
+
+func (r rect) String() string {
+	return fmt.Sprintf("%dx%d", r.w, r.h)
+}
+
+type sizer interface {
+	size() int
+}
+
+type bag []int
+
+func (b bag) size() int {
+	return len(b)
+}
+
+func (b bag) sum() int {
+	s := 0
+	for _, v := range b {
+		s += v
+	}
+	return s
+}
+
+func total[T sizer](xs ...T) int {
+	n := 0
+	for _, x := range xs {
+		n += x.size()
+	}
+	return n
+}
+
+type byLen []string
+
+func (s byLen) Len() int           { return len(s) }
+func (s byLen) Less(i, j int) bool { return len(s[i]) < len(s[j]) }
+func (s byLen) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type seg struct {
+	xs []int
+}
+
+func (s *seg) Len() int           { return len(s.xs) }
+func (s *seg) Less(i, j int) bool { return s.xs[i] < s.xs[j] }
+func (s *seg) Swap(i, j int)      { s.xs[i], s.xs[j] = s.xs[j], s.xs[i] }
+
+func (s *seg) String() string {
+	return fmt.Sprint("seg", s.xs)
+}
+
+func (s *seg) Unused() int {
+	return len(s.xs)
+}
+
+func main() {
+	s := lib.NewSet[int]()
+	s.Add(1)
+	fmt.Println(s.Has(1), s.Has(2))
+
+	v := lib.Vec{X: 1, Y: 2}
+	scale := v.Scale
+	fmt.Println(v.Add(scale(3)))
+
+	var c counter
+	c.Inc()
+	fmt.Println(c.Inc())
+
+	shapes := []shape{rect{2, 3}}
+	fmt.Println(shapes[0].area(), shapes[0])
+	if l, ok := shapes[0].(interface{ label() string }); ok {
+		fmt.Println(l.label())
+	}
+
+	fmt.Println(total(bag{1, 2}, bag{3}))
+
+	words := byLen{"ccc", "a", "bb"}
+	sort.Sort(words)
+	fmt.Println(words)
+
+	sg := &seg{[]int{3, 1, 2}}
+	sort.Sort(sg)
+	fmt.Println(sg.xs)
+}
@@ -0,0 +1,3 @@
+module github.com/ktateish/gottani/testdata/sideeffects
+
+go 1.23
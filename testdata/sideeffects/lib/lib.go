@@ -0,0 +1,53 @@
+package lib
+
+import "fmt"
+
+var registry []string
+
+func Register(name string) bool {
+	registry = append(registry, name)
+	return true
+}
+
+func Names() []string {
+	return registry
+}
+
+var _ = Register("builtin")
+
+type Shape interface {
+	Area() int
+}
+
+type Square struct {
+	n int
+}
+
+func (s *Square) Area() int {
+	return s.n * s.n
+}
+
+var _ Shape = (*Square)(nil)
+
+var table = build()
+
+func build() []int {
+	fmt.Println("building table")
+	return []int{1, 2, 3}
+}
+
+var unused = len("unused")
+
+type Big int
+
+type Pair[T any] struct {
+	a, b T
+}
+
+// conversions have no side effects
+var (
+	Unused    = Big(1) << 40
+	UnusedStr = []byte("unused")
+	UnusedPtr = (*Pair[int])(nil)
+	UnusedMap = map[string]Big(nil)
+)
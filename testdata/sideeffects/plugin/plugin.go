@@ -0,0 +1,7 @@
+package plugin
+
+import "github.com/ktateish/gottani/testdata/sideeffects/lib"
+
+func init() {
+	lib.Register("plugin")
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/ktateish/gottani/testdata/sideeffects/lib"
+	_ "github.com/ktateish/gottani/testdata/sideeffects/plugin"
+)
+
+func main() {
+	fmt.Println(lib.Names())
+}
@@ -0,0 +1,7 @@
+module github.com/ktateish/gottani/testdata/target
+
+go 1.23
+
+replace example.com/lib => ./lib
+
+require example.com/lib v0.0.0-00010101000000-000000000000
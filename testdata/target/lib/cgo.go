@@ -0,0 +1,9 @@
+package lib
+
+// int answer() { return 42; }
+import "C"
+
+// Cgo returns whether cgo is used
+func Cgo() string {
+	return "cgo"
+}
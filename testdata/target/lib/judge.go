@@ -0,0 +1,8 @@
+//go:build judge
+
+package lib
+
+// Env returns the name of the environment
+func Env() string {
+	return "judge"
+}
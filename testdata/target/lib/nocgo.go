@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package lib
+
+// Cgo returns whether cgo is used
+func Cgo() string {
+	return "nocgo"
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package lib
+
+// OS returns the target OS
+func OS() string {
+	return "other"
+}
@@ -0,0 +1,6 @@
+package lib
+
+// OS returns the target OS
+func OS() string {
+	return "windows"
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/lib"
+)
+
+func main() {
+	fmt.Println(lib.OS())
+	fmt.Println(lib.Env())
+	fmt.Println(lib.Cgo())
+}
@@ -0,0 +1,10 @@
+package lib
+
+// Sum returns the sum of the given values
+func Sum(a ...int) int {
+	var res int
+	for _, x := range a {
+		res += x
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package gottani
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ktateish/gottani/internal/pkginfo"
+)
+
+// Watch combines the application in the dir like Combine and calls fn with
+// the result.  Then it polls the directories and the files of the
+// non-standard packages of the application every interval, and combines it
+// again whenever any of them has been changed until ctx is done.  Only the
+// changed packages are loaded again.  It returns ctx.Err(), or the error of
+// the options of the Combiner without watching.
+func (c *Combiner) Watch(ctx context.Context, dir, entryPointName string, interval time.Duration, fn func(src []byte, err error)) error {
+	return c.watch(ctx, func() (*pkginfo.PackageInfo, error) {
+		return pkginfo.NewWithCache(dir, c.cache)
+	}, []string{dir}, entryPointName, interval, fn)
+}
+
+// WatchFiles is the same as Watch but the package of the entry point
+// consists of the given files like CombineFiles.
+func (c *Combiner) WatchFiles(ctx context.Context, files []string, entryPointName string, interval time.Duration, fn func(src []byte, err error)) error {
+	return c.watch(ctx, func() (*pkginfo.PackageInfo, error) {
+		return pkginfo.NewFilesWithCache(files, c.cache)
+	}, files, entryPointName, interval, fn)
+}
+
+// watch combines the application loaded by the load function and watches
+// its files in addition to the given paths
+func (c *Combiner) watch(ctx context.Context, load func() (*pkginfo.PackageInfo, error), paths []string, entryPointName string, interval time.Duration, fn func([]byte, error)) error {
+	if c.err != nil {
+		fn(nil, c.err)
+		return c.err
+	}
+	for {
+		pi, src, err := c.combine(load, entryPointName)
+		fn(src, err)
+
+		files := pi.SourceFiles()
+		for _, path := range paths {
+			if abs, err := filepath.Abs(path); err == nil {
+				files = append(files, abs)
+			}
+		}
+		stamps := statFiles(files)
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+			if !slices.Equal(statFiles(files), stamps) {
+				break
+			}
+		}
+	}
+}
+
+// fileState is the state of a file or a directory for detecting changes
+type fileState struct {
+	path    string
+	exists  bool
+	modTime int64
+	size    int64
+	goFiles string // names of .go files in the directory
+}
+
+// statFiles returns the states of the given files.  Directories are compared
+// by the names of their .go files so that writing other files in them, e.g.
+// the combined source, isn't a change.
+func statFiles(files []string) []fileState {
+	res := make([]fileState, 0, len(files))
+	for _, path := range files {
+		st := fileState{path: path}
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			st.exists = true
+			ents, _ := os.ReadDir(path)
+			var names []string
+			for _, ent := range ents {
+				if strings.HasSuffix(ent.Name(), ".go") {
+					names = append(names, ent.Name())
+				}
+			}
+			st.goFiles = strings.Join(names, "\x00")
+		} else if err == nil {
+			st.exists = true
+			st.modTime = fi.ModTime().UnixNano()
+			st.size = fi.Size()
+		}
+		res = append(res, st)
+	}
+	return res
+}